@@ -0,0 +1,225 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+
+	"github.com/af-go/peach-common/cmd/version"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultAdminPrefix = "/admin"
+	redactedValue      = "******"
+)
+
+// sensitiveKeys configuration keys whose values are redacted, matched case insensitively as substrings
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "privatekey", "credential"}
+
+// referenceSuffixes keys which name where a secret lives rather than hold it, e.g. tokenEnvVar or privateKeyFile
+var referenceSuffixes = []string{"file", "envvar", "header", "claim", "path"}
+
+// AdminOptions admin handler options
+type AdminOptions struct {
+	// Prefix route prefix, default /admin
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// Roles principal must have one of the roles, any authenticated principal is allowed if empty
+	Roles []string `json:"roles" yaml:"roles"`
+}
+
+// LogLevel log level of admin api, Verbosity is the logr V level enabled
+type LogLevel struct {
+	Level     string `json:"level,omitempty" example:"debug"`
+	Verbosity *int   `json:"verbosity,omitempty" example:"1"`
+}
+
+// RouteInfo registered route
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Handler string `json:"handler"`
+}
+
+// NewAdminHandler create admin handler, level is from log.NewLoggerWithLevel and config is the effective configuration
+func NewAdminHandler(options AdminOptions, level zap.AtomicLevel, config interface{}) *AdminHandler {
+	if options.Prefix == "" {
+		options.Prefix = defaultAdminPrefix
+	}
+	return &AdminHandler{options: options, level: level, config: config}
+}
+
+// AdminHandler runtime admin endpoints
+type AdminHandler struct {
+	options AdminOptions
+	level   zap.AtomicLevel
+	config  interface{}
+	engine  *gin.Engine
+}
+
+// Build build admin handler
+func (h *AdminHandler) Build(engine *gin.Engine) {
+	h.engine = engine
+	guard := RequireAuthentication()
+	if len(h.options.Roles) > 0 {
+		guard = RequireRoles(h.options.Roles...)
+	}
+	group := engine.Group(h.options.Prefix, guard)
+	group.GET("/loglevel", h.GetLogLevel)
+	group.PUT("/loglevel", Wrap(h.SetLogLevel))
+	group.GET("/routes", h.ListRoutes)
+	group.GET("/buildinfo", h.BuildInfo)
+	group.GET("/goroutines", h.Goroutines)
+	group.GET("/config", Wrap(h.Config))
+}
+
+// Routes implements Describer
+func (h *AdminHandler) Routes() []Route {
+	tags := []string{"admin"}
+	failures := []int{http.StatusUnauthorized, http.StatusForbidden}
+	return []Route{
+		{Method: http.MethodGet, Path: h.options.Prefix + "/loglevel", Summary: "get log level", Tags: tags, Response: LogLevel{}, Errors: failures},
+		{Method: http.MethodPut, Path: h.options.Prefix + "/loglevel", Summary: "set log level", Tags: tags, Request: LogLevel{}, Response: LogLevel{}, Errors: append(failures, http.StatusBadRequest)},
+		{Method: http.MethodGet, Path: h.options.Prefix + "/routes", Summary: "list registered routes", Tags: tags, Response: []RouteInfo{}, Errors: failures},
+		{Method: http.MethodGet, Path: h.options.Prefix + "/buildinfo", Summary: "show build information", Tags: tags, Response: version.Version{}, Errors: failures},
+		{Method: http.MethodGet, Path: h.options.Prefix + "/goroutines", Summary: "dump goroutines as text", Tags: tags, Errors: failures},
+		{Method: http.MethodGet, Path: h.options.Prefix + "/config", Summary: "show effective configuration with secrets redacted", Tags: tags, Response: map[string]interface{}{}, Errors: failures},
+	}
+}
+
+// GetLogLevel get current log level
+func (h *AdminHandler) GetLogLevel(gc *gin.Context) {
+	gc.JSON(http.StatusOK, currentLogLevel(h.level))
+}
+
+// SetLogLevel set log level by name, e.g. debug, or by logr verbosity
+func (h *AdminHandler) SetLogLevel(gc *gin.Context) error {
+	var req LogLevel
+	if err := gc.ShouldBindJSON(&req); err != nil {
+		return NewProblem(http.StatusBadRequest, err.Error())
+	}
+	if req.Verbosity != nil {
+		if *req.Verbosity < 0 {
+			return NewProblem(http.StatusBadRequest, "verbosity must not be negative")
+		}
+		h.level.SetLevel(zapcore.Level(-*req.Verbosity))
+	} else {
+		var l zapcore.Level
+		if err := l.UnmarshalText([]byte(req.Level)); err != nil {
+			return NewProblem(http.StatusBadRequest, err.Error())
+		}
+		h.level.SetLevel(l)
+	}
+	gc.JSON(http.StatusOK, currentLogLevel(h.level))
+	return nil
+}
+
+// ListRoutes list routes registered on the engine
+func (h *AdminHandler) ListRoutes(gc *gin.Context) {
+	routes := []RouteInfo{}
+	for _, r := range h.engine.Routes() {
+		routes = append(routes, RouteInfo{Method: r.Method, Path: r.Path, Handler: r.Handler})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	gc.JSON(http.StatusOK, routes)
+}
+
+// BuildInfo show build information
+func (h *AdminHandler) BuildInfo(gc *gin.Context) {
+	gc.JSON(http.StatusOK, version.New())
+}
+
+// Goroutines dump stacks of all goroutines, debug=1 groups identical stacks
+func (h *AdminHandler) Goroutines(gc *gin.Context) {
+	debug := 2
+	if gc.Query("debug") == "1" {
+		debug = 1
+	}
+	gc.Header("Content-Type", "text/plain; charset=utf-8")
+	gc.Header("X-Goroutines", fmt.Sprintf("%d", runtime.NumGoroutine()))
+	gc.Status(http.StatusOK)
+	_ = pprof.Lookup("goroutine").WriteTo(gc.Writer, debug)
+}
+
+// Config show effective configuration with secrets redacted
+func (h *AdminHandler) Config(gc *gin.Context) error {
+	redacted, err := Redact(h.config)
+	if err != nil {
+		return err
+	}
+	gc.JSON(http.StatusOK, redacted)
+	return nil
+}
+
+// Redact convert value to its json form and mask values of sensitive keys, e.g. password or token
+func Redact(v interface{}) (interface{}, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m interface{}
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, err
+	}
+	return redactValue(m), nil
+}
+
+func redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			if isSensitive(k) {
+				if item != nil && item != "" {
+					value[k] = redactedValue
+				}
+				continue
+			}
+			value[k] = redactValue(item)
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactValue(item)
+		}
+		return value
+	}
+	return v
+}
+
+func isSensitive(key string) bool {
+	k := strings.ToLower(key)
+	if k == "key" {
+		return true
+	}
+	for _, suffix := range referenceSuffixes {
+		if strings.HasSuffix(k, suffix) {
+			return false
+		}
+	}
+	for _, s := range sensitiveKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func currentLogLevel(level zap.AtomicLevel) LogLevel {
+	l := level.Level()
+	verbosity := 0
+	if l < 0 {
+		verbosity = -int(l)
+	}
+	return LogLevel{Level: l.String(), Verbosity: &verbosity}
+}
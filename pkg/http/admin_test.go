@@ -0,0 +1,82 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/af-go/peach-common/pkg/log"
+	model "github.com/af-go/peach-common/pkg/model/database"
+	"github.com/gin-gonic/gin"
+)
+
+type adminTestConfig struct {
+	Server ServerOptions      `json:"server"`
+	MySQL  model.MySQLOptions `json:"mysql"`
+	Keys   []APIKey           `json:"keys"`
+}
+
+func TestAdminHandler(t *testing.T) {
+	logger, level := log.NewLoggerWithLevel(false)
+	config := adminTestConfig{
+		Server: ServerOptions{Port: 8080, PrivateKeyFile: "/etc/tls/key.pem"},
+		MySQL:  model.MySQLOptions{Host: "db", Username: "root", Password: "Passwd123"},
+		Keys:   []APIKey{{Key: "k-123", Subject: "ci"}},
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(gc *gin.Context) {
+		if gc.GetHeader("X-Anonymous") == "" {
+			gc.Set(principalKey, &Principal{Subject: "ops"})
+		}
+	})
+	NewAdminHandler(AdminOptions{}, level, config).Build(r)
+
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	anonymous := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	anonymous.Header.Set("X-Anonymous", "true")
+	w := httptest.NewRecorder()
+	if r.ServeHTTP(w, anonymous); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expect anonymous request rejected without roles, actual %d", w.Code)
+	}
+	if logger.V(1).Enabled() {
+		t.Fatalf("expect debug disabled in production logger")
+	}
+	if w := do(http.MethodPut, "/admin/loglevel", `{"level": "debug"}`); w.Code != 200 {
+		t.Fatalf("failed to set log level %d %s", w.Code, w.Body.String())
+	}
+	if !logger.V(1).Enabled() {
+		t.Fatalf("expect debug enabled after level change")
+	}
+	if w := do(http.MethodPut, "/admin/loglevel", `{"level": "loud"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for unknown level, actual %d", w.Code)
+	}
+
+	w = do(http.MethodGet, "/admin/config", "")
+	var redacted adminTestConfig
+	content := w.Body.String()
+	if err := json.Unmarshal(w.Body.Bytes(), &redacted); err != nil {
+		t.Fatalf("failed to unmarshal config %v", err)
+	}
+	if redacted.MySQL.Password != redactedValue || strings.Contains(content, "Passwd123") || strings.Contains(content, "k-123") {
+		t.Fatalf("expect secrets redacted, actual %s", content)
+	}
+	if redacted.Server.PrivateKeyFile != "/etc/tls/key.pem" || redacted.MySQL.Username != "root" {
+		t.Fatalf("expect non secret values kept, actual %s", content)
+	}
+
+	w = do(http.MethodGet, "/admin/routes", "")
+	if !strings.Contains(w.Body.String(), "/admin/goroutines") {
+		t.Fatalf("expect routes listed, actual %s", w.Body.String())
+	}
+	w = do(http.MethodGet, "/admin/goroutines", "")
+	if !strings.Contains(w.Body.String(), "goroutine") {
+		t.Fatalf("expect goroutine dump, actual %s", w.Body.String())
+	}
+}
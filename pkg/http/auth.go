@@ -0,0 +1,363 @@
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/af-go/peach-common/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-logr/logr"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	principalKey = "peach.principal"
+
+	defaultAPIKeyHeader = "X-API-Key"
+	defaultRealm        = "peach"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+var ErrUnauthenticated = errors.New("authentication is required")
+var ErrForbidden = errors.New("insufficient permission")
+
+// Principal authenticated caller
+type Principal struct {
+	Subject string                 `json:"subject"`
+	Method  string                 `json:"method"`
+	Scopes  []string               `json:"scopes,omitempty"`
+	Roles   []string               `json:"roles,omitempty"`
+	Claims  map[string]interface{} `json:"claims,omitempty"`
+}
+
+// HasScope check whether principal is granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+// HasRole check whether principal is granted the role
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+// Authenticator authenticate a request.
+// It returns nil principal and nil error when the request carries no credentials it understands,
+// and ErrInvalidCredentials when credentials are present but rejected.
+type Authenticator interface {
+	Authenticate(req *http.Request) (*Principal, error)
+}
+
+// AuthOptions authentication options, each configured method is tried in order: mTLS, JWT, API key, basic
+type AuthOptions struct {
+	JWT    *JWTOptions       `json:"jwt,omitempty" yaml:"jwt,omitempty"`
+	APIKey *APIKeyOptions    `json:"apiKey,omitempty" yaml:"apiKey,omitempty"`
+	Basic  *BasicAuthOptions `json:"basic,omitempty" yaml:"basic,omitempty"`
+	MTLS   *MTLSOptions      `json:"mtls,omitempty" yaml:"mtls,omitempty"`
+}
+
+// Enabled whether any authentication method is configured
+func (o AuthOptions) Enabled() bool {
+	return o.JWT != nil || o.APIKey != nil || o.Basic != nil || o.MTLS != nil
+}
+
+// BuildAuthenticators create authenticators from options
+func BuildAuthenticators(options AuthOptions, logger *logr.Logger) ([]Authenticator, error) {
+	authenticators := []Authenticator{}
+	if options.MTLS != nil {
+		authenticators = append(authenticators, NewMTLSAuthenticator(*options.MTLS))
+	}
+	if options.JWT != nil {
+		a, err := NewJWTAuthenticator(*options.JWT, logger)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+	if options.APIKey != nil {
+		a, err := NewAPIKeyAuthenticator(*options.APIKey, logger)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+	if options.Basic != nil {
+		a, err := NewBasicAuthenticator(*options.Basic, logger)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, a)
+	}
+	return authenticators, nil
+}
+
+// NewAuthMiddleware create middleware which authenticates the request and stores the principal in gin context.
+// Requests without credentials pass through anonymously, use RequireAuthentication, RequireScopes or RequireRoles to protect routes.
+func NewAuthMiddleware(logger *logr.Logger, authenticators ...Authenticator) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		for _, a := range authenticators {
+			principal, err := a.Authenticate(gc.Request)
+			if err != nil {
+				logger.V(1).Info("authentication failed", "path", gc.Request.URL.Path, "client", gc.ClientIP(), "err", err.Error())
+				if b, ok := a.(*BasicAuthenticator); ok {
+					gc.Header("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", b.realm))
+				}
+				abortWithError(gc, http.StatusUnauthorized, err)
+				return
+			}
+			if principal != nil {
+				gc.Set(principalKey, principal)
+				break
+			}
+		}
+		gc.Next()
+	}
+}
+
+// GetPrincipal get authenticated principal from gin context
+func GetPrincipal(gc *gin.Context) (*Principal, bool) {
+	v, ok := gc.Get(principalKey)
+	if !ok {
+		return nil, false
+	}
+	p, ok := v.(*Principal)
+	return p, ok
+}
+
+// RequireAuthentication reject anonymous requests
+func RequireAuthentication() gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		if _, ok := GetPrincipal(gc); !ok {
+			abortWithError(gc, http.StatusUnauthorized, ErrUnauthenticated)
+			return
+		}
+		gc.Next()
+	}
+}
+
+// RequireScopes reject requests whose principal is not granted all of the scopes
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		p, ok := GetPrincipal(gc)
+		if !ok {
+			abortWithError(gc, http.StatusUnauthorized, ErrUnauthenticated)
+			return
+		}
+		for _, s := range scopes {
+			if !p.HasScope(s) {
+				abortWithError(gc, http.StatusForbidden, fmt.Errorf("%w: scope %s is required", ErrForbidden, s))
+				return
+			}
+		}
+		gc.Next()
+	}
+}
+
+// RequireRoles reject requests whose principal has none of the roles
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		p, ok := GetPrincipal(gc)
+		if !ok {
+			abortWithError(gc, http.StatusUnauthorized, ErrUnauthenticated)
+			return
+		}
+		for _, r := range roles {
+			if p.HasRole(r) {
+				gc.Next()
+				return
+			}
+		}
+		abortWithError(gc, http.StatusForbidden, fmt.Errorf("%w: one of roles %v is required", ErrForbidden, roles))
+	}
+}
+
+func abortWithError(gc *gin.Context, status int, err error) {
+	RenderProblem(gc, NewProblem(status, err.Error()))
+	gc.Abort()
+}
+
+// APIKeyOptions static api key options
+type APIKeyOptions struct {
+	// File json or yaml file contains a list of APIKey
+	File   string `json:"file" yaml:"file"`
+	Header string `json:"header" yaml:"header"`
+}
+
+// APIKey static api key and the identity it maps to
+type APIKey struct {
+	Key     string   `json:"key" yaml:"key"`
+	Subject string   `json:"subject" yaml:"subject"`
+	Scopes  []string `json:"scopes" yaml:"scopes"`
+	Roles   []string `json:"roles" yaml:"roles"`
+}
+
+// NewAPIKeyAuthenticator create api key authenticator, keys are loaded from options.File
+func NewAPIKeyAuthenticator(options APIKeyOptions, logger *logr.Logger) (*APIKeyAuthenticator, error) {
+	keys := []APIKey{}
+	if err := utils.Load(options.File, &keys, logger); err != nil {
+		return nil, err
+	}
+	header := options.Header
+	if header == "" {
+		header = defaultAPIKeyHeader
+	}
+	return &APIKeyAuthenticator{header: header, keys: keys}, nil
+}
+
+// APIKeyAuthenticator authenticate request by api key header
+type APIKeyAuthenticator struct {
+	header string
+	keys   []APIKey
+}
+
+// Authenticate implements Authenticator
+func (a *APIKeyAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	value := req.Header.Get(a.header)
+	if value == "" {
+		return nil, nil
+	}
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(value)) == 1 {
+			return &Principal{Subject: k.Subject, Method: "apikey", Scopes: k.Scopes, Roles: k.Roles}, nil
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// BasicAuthOptions http basic auth options
+type BasicAuthOptions struct {
+	// File json or yaml file contains a list of BasicUser
+	File  string `json:"file" yaml:"file"`
+	Realm string `json:"realm" yaml:"realm"`
+}
+
+// BasicUser user with bcrypt password hash
+type BasicUser struct {
+	Username     string   `json:"username" yaml:"username"`
+	PasswordHash string   `json:"passwordHash" yaml:"passwordHash"`
+	Scopes       []string `json:"scopes" yaml:"scopes"`
+	Roles        []string `json:"roles" yaml:"roles"`
+}
+
+// NewBasicAuthenticator create basic authenticator, users are loaded from options.File
+func NewBasicAuthenticator(options BasicAuthOptions, logger *logr.Logger) (*BasicAuthenticator, error) {
+	users := []BasicUser{}
+	if err := utils.Load(options.File, &users, logger); err != nil {
+		return nil, err
+	}
+	realm := options.Realm
+	if realm == "" {
+		realm = defaultRealm
+	}
+	a := BasicAuthenticator{realm: realm, users: make(map[string]BasicUser)}
+	cost := bcrypt.DefaultCost
+	for _, u := range users {
+		a.users[u.Username] = u
+		if c, err := bcrypt.Cost([]byte(u.PasswordHash)); err == nil && c > cost {
+			cost = c
+		}
+	}
+	// unknown users are compared against a hash of the same cost, so response time does not reveal usernames
+	dummy, err := bcrypt.GenerateFromPassword([]byte("peach.dummy"), cost)
+	if err != nil {
+		return nil, err
+	}
+	a.dummyHash = dummy
+	return &a, nil
+}
+
+// BasicAuthenticator authenticate request by http basic auth against bcrypt hashes
+type BasicAuthenticator struct {
+	realm     string
+	users     map[string]BasicUser
+	dummyHash []byte
+}
+
+// Authenticate implements Authenticator
+func (a *BasicAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	username, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	u, ok := a.users[username]
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(a.dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Subject: u.Username, Method: "basic", Scopes: u.Scopes, Roles: u.Roles}, nil
+}
+
+// MTLSOptions client certificate options, the server must be started with TLS and CAFile
+type MTLSOptions struct {
+	Subjects []MTLSSubject `json:"subjects" yaml:"subjects"`
+	// AllowUnmapped accept verified certificates which match no subject, the common name becomes the principal
+	AllowUnmapped bool `json:"allowUnmapped" yaml:"allowUnmapped"`
+}
+
+// MTLSSubject map certificate subject to principal
+type MTLSSubject struct {
+	// CommonName certificate subject common name
+	CommonName string `json:"commonName" yaml:"commonName"`
+	// Organization optional certificate subject organization
+	Organization string   `json:"organization" yaml:"organization"`
+	Principal    string   `json:"principal" yaml:"principal"`
+	Scopes       []string `json:"scopes" yaml:"scopes"`
+	Roles        []string `json:"roles" yaml:"roles"`
+}
+
+// NewMTLSAuthenticator create client certificate authenticator
+func NewMTLSAuthenticator(options MTLSOptions) *MTLSAuthenticator {
+	return &MTLSAuthenticator{options: options}
+}
+
+// MTLSAuthenticator authenticate request by verified client certificate
+type MTLSAuthenticator struct {
+	options MTLSOptions
+}
+
+// Authenticate implements Authenticator
+func (a *MTLSAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	subject := req.TLS.VerifiedChains[0][0].Subject
+	for _, s := range a.options.Subjects {
+		if s.CommonName != subject.CommonName {
+			continue
+		}
+		if s.Organization != "" && !contains(subject.Organization, s.Organization) {
+			continue
+		}
+		name := s.Principal
+		if name == "" {
+			name = subject.CommonName
+		}
+		return &Principal{Subject: name, Method: "mtls", Scopes: s.Scopes, Roles: s.Roles}, nil
+	}
+	if a.options.AllowUnmapped {
+		return &Principal{Subject: subject.CommonName, Method: "mtls"}, nil
+	}
+	return nil, ErrInvalidCredentials
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func bearerToken(req *http.Request) string {
+	h := req.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/af-go/peach-common/pkg/log"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAuthenticators(t *testing.T) {
+	logger := log.NewLogger(true)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key %v", err)
+	}
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	content, _ := json.Marshal(jwks)
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, content, 0600); err != nil {
+		t.Fatalf("failed to write jwks %v", err)
+	}
+
+	options := AuthOptions{
+		JWT:    &JWTOptions{JWKSFile: jwksFile, Issuer: "peach", Audiences: []string{"api"}},
+		APIKey: &APIKeyOptions{File: "testdata/apikeys.yaml"},
+		Basic:  &BasicAuthOptions{File: "testdata/users.yaml"},
+	}
+	authenticators, err := BuildAuthenticators(options, logger)
+	if err != nil {
+		t.Fatalf("failed to build authenticators %v", err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(NewAuthMiddleware(logger, authenticators...))
+	r.GET("/public", func(gc *gin.Context) { gc.JSON(200, StatusResponse{Message: "Up"}) })
+	r.GET("/reports", RequireScopes("reports:read"), func(gc *gin.Context) {
+		p, _ := GetPrincipal(gc)
+		gc.JSON(200, StatusResponse{Message: p.Subject})
+	})
+	r.GET("/admin", RequireRoles("admin"), func(gc *gin.Context) { gc.JSON(200, StatusResponse{Message: "ok"}) })
+
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token %v", err)
+		}
+		return s
+	}
+	valid := sign(jwt.MapClaims{"sub": "bob", "iss": "peach", "aud": "api", "scope": "reports:read", "exp": time.Now().Add(time.Minute).Unix()})
+	expired := sign(jwt.MapClaims{"sub": "bob", "iss": "peach", "aud": "api", "exp": time.Now().Add(-time.Minute).Unix()})
+	wrongAudience := sign(jwt.MapClaims{"sub": "bob", "iss": "peach", "aud": "other", "exp": time.Now().Add(time.Minute).Unix()})
+
+	cases := []struct {
+		name   string
+		path   string
+		header map[string]string
+		basic  []string
+		status int
+	}{
+		{name: "anonymous public", path: "/public", status: 200},
+		{name: "anonymous protected", path: "/reports", status: 401},
+		{name: "jwt", path: "/reports", header: map[string]string{"Authorization": "Bearer " + valid}, status: 200},
+		{name: "jwt expired", path: "/public", header: map[string]string{"Authorization": "Bearer " + expired}, status: 401},
+		{name: "jwt audience", path: "/public", header: map[string]string{"Authorization": "Bearer " + wrongAudience}, status: 401},
+		{name: "jwt missing role", path: "/admin", header: map[string]string{"Authorization": "Bearer " + valid}, status: 403},
+		{name: "api key", path: "/reports", header: map[string]string{"X-API-Key": "3f8a1c2e-test-key"}, status: 200},
+		{name: "api key invalid", path: "/reports", header: map[string]string{"X-API-Key": "nope"}, status: 401},
+		{name: "basic", path: "/admin", basic: []string{"alice", "secret"}, status: 200},
+		{name: "basic wrong password", path: "/admin", basic: []string{"alice", "guess"}, status: 401},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		for k, v := range c.header {
+			req.Header.Set(k, v)
+		}
+		if c.basic != nil {
+			req.SetBasicAuth(c.basic[0], c.basic[1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s: expect status %d, actual %d (%s)", c.name, c.status, w.Code, w.Body.String())
+		}
+	}
+}
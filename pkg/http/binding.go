@@ -0,0 +1,149 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Handle adapt a business function to gin handler.
+// Path, query, header and json body are bound into Req by uri, form, header and json tags, then Req is validated by binding tags once.
+// Resp is rendered with status on success, errors are rendered as problem details by DefaultErrorRegistry.
+// The context passed to fn is the request context, cancelled when the client goes away, it carries the principal, see PrincipalFromContext.
+func Handle[Req any, Resp any](status int, fn func(ctx context.Context, req Req) (Resp, error)) gin.HandlerFunc {
+	return Wrap(func(gc *gin.Context) error {
+		var req Req
+		if err := Bind(gc, &req); err != nil {
+			return err
+		}
+		ctx := gc.Request.Context()
+		if p, ok := GetPrincipal(gc); ok {
+			ctx = context.WithValue(ctx, principalContextKey{}, p)
+		}
+		resp, err := fn(ctx, req)
+		if err != nil {
+			return err
+		}
+		if status == http.StatusNoContent {
+			gc.Status(status)
+			return nil
+		}
+		gc.JSON(status, resp)
+		return nil
+	})
+}
+
+// Bind bind query, header, json body and path into obj, then validate it.
+// Query and headers are only bound into fields with explicit form and header tags, path is bound last so it can't be overridden.
+// Binding errors are returned as 400 problems, validation errors as validator.ValidationErrors.
+func Bind(gc *gin.Context, obj interface{}) error {
+	t := reflect.TypeOf(obj)
+	if gc.Request.URL.RawQuery != "" {
+		query := gc.Request.URL.Query()
+		values := taggedValues(t, "form", func(name string) []string { return query[name] })
+		if err := binding.MapFormWithTag(obj, values, "form"); err != nil {
+			return NewProblem(http.StatusBadRequest, err.Error())
+		}
+	}
+	values := taggedValues(t, "header", gc.Request.Header.Values)
+	if err := binding.MapFormWithTag(obj, values, "header"); err != nil {
+		return NewProblem(http.StatusBadRequest, err.Error())
+	}
+	if hasBody(gc.Request) {
+		if err := ignoreValidation(binding.JSON.Bind(gc.Request, obj)); err != nil && !errors.Is(err, io.EOF) {
+			return NewProblem(http.StatusBadRequest, err.Error())
+		}
+	}
+	if len(gc.Params) > 0 {
+		values := taggedValues(t, "uri", func(name string) []string {
+			if v, ok := gc.Params.Get(name); ok {
+				return []string{v}
+			}
+			return nil
+		})
+		if err := binding.MapFormWithTag(obj, values, "uri"); err != nil {
+			return NewProblem(http.StatusBadRequest, err.Error())
+		}
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// taggedValues look up values of names explicitly declared by tag in t,
+// gin falls back to go field names for untagged fields, so names of untagged fields are never returned
+func taggedValues(t reflect.Type, tag string, lookup func(name string) []string) map[string][]string {
+	tagged := make(map[string]bool)
+	untagged := make(map[string]bool)
+	collectTagNames(t, tag, tagged, untagged)
+	values := make(map[string][]string)
+	for name := range tagged {
+		if untagged[name] {
+			continue
+		}
+		if v := lookup(name); len(v) > 0 {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+func collectTagNames(t reflect.Type, tag string, tagged map[string]bool, untagged map[string]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		name := strings.SplitN(f.Tag.Get(tag), ",", 2)[0]
+		switch name {
+		case "-":
+		case "":
+			untagged[f.Name] = true
+			collectTagNames(f.Type, tag, tagged, untagged)
+		default:
+			tagged[name] = true
+		}
+	}
+}
+
+type principalContextKey struct{}
+
+// PrincipalFromContext get authenticated principal from context passed by Handle, or from *gin.Context
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	if gc, ok := ctx.(*gin.Context); ok {
+		return GetPrincipal(gc)
+	}
+	p, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return p, ok
+}
+
+// DescribeRoute document route of Handle with its request and response types, for OpenAPIHandler
+func DescribeRoute[Req any, Resp any](method string, path string, summary string, status int, failures ...int) Route {
+	var req Req
+	var resp Resp
+	return Route{Method: method, Path: path, Summary: summary, Request: req, Response: resp, SuccessStatus: status, Errors: append([]int{http.StatusBadRequest}, failures...)}
+}
+
+// ignoreValidation gin binders validate after every bind, Bind validates once when all sources are bound
+func ignoreValidation(err error) error {
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		return nil
+	}
+	return err
+}
+
+func hasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0
+}
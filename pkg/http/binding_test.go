@@ -0,0 +1,107 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type renameRequest struct {
+	ID        int    `uri:"id" json:"-" binding:"required,min=1"`
+	DryRun    bool   `form:"dryRun" json:"-"`
+	RequestID string `header:"X-Request-Id" json:"-" binding:"required"`
+	Name      string `json:"name" binding:"required,max=16"`
+}
+
+type renameResponse struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	DryRun    bool   `json:"dryRun"`
+	RequestID string `json:"requestId"`
+}
+
+func TestHandle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PUT("/items/:id/name", Handle(http.StatusOK, func(ctx context.Context, req renameRequest) (renameResponse, error) {
+		if req.ID == 404 {
+			return renameResponse{}, HTTPError{Code: http.StatusNotFound, Message: "item is not found"}
+		}
+		return renameResponse{ID: req.ID, Name: req.Name, DryRun: req.DryRun, RequestID: req.RequestID}, nil
+	}))
+
+	do := func(path string, body string, requestID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if requestID != "" {
+			req.Header.Set("X-Request-Id", requestID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/items/7/name?dryRun=true", `{"name": "pear"}`, "r-1")
+	var resp renameResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || resp != (renameResponse{ID: 7, Name: "pear", DryRun: true, RequestID: "r-1"}) {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+
+	w = do("/items/0/name", `{}`, "")
+	var p Problem
+	_ = json.Unmarshal(w.Body.Bytes(), &p)
+	if fields, _ := p.Extensions["errors"].([]interface{}); w.Code != http.StatusBadRequest || len(fields) != 3 {
+		t.Fatalf("expect 3 field errors, actual %d %s", w.Code, w.Body.String())
+	}
+
+	w = do("/items/7/name?ID=99&id=99&Name=admin", `{"name": "pear"}`, "r-1")
+	resp = renameResponse{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || resp.ID != 7 || resp.Name != "pear" {
+		t.Fatalf("expect path parameter and body not overridden by query, actual %d %s", w.Code, w.Body.String())
+	}
+
+	if w = do("/items/x/name", `{"name": "pear"}`, "r-1"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for invalid path parameter, actual %d", w.Code)
+	}
+	if w = do("/items/7/name", `{"name": `, "r-1"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400 for malformed body, actual %d", w.Code)
+	}
+	if w = do("/items/404/name", `{"name": "pear"}`, "r-1"); w.Code != http.StatusNotFound {
+		t.Fatalf("expect mapped 404, actual %d", w.Code)
+	}
+}
+
+func TestHandleContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(gc *gin.Context) {
+		gc.Set(principalKey, &Principal{Subject: "alice", Method: "jwt"})
+	})
+	r.PUT("/items/:id/name", Handle(http.StatusOK, func(ctx context.Context, req renameRequest) (renameResponse, error) {
+		p, ok := PrincipalFromContext(ctx)
+		if !ok || ctx.Done() == nil {
+			return renameResponse{}, errors.New("context is not the request context")
+		}
+		return renameResponse{ID: req.ID, Name: p.Subject}, nil
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPut, "/items/7/name", strings.NewReader(`{"name": "pear"}`)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Id", "r-1")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp renameResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != 200 || resp.Name != "alice" {
+		t.Fatalf("expect principal in request context, actual %d %s", w.Code, w.Body.String())
+	}
+}
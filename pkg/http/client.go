@@ -12,26 +12,14 @@ import (
 	"github.com/go-logr/logr"
 )
 
-// BuidlCookieHeader buidl cookie header, for example, <name>=<value>[;expires=<date>][;domain=<domain_name>][;path=<path>][;secure][;httponly]
+// BuildCookieHeader build Set-Cookie header, for example, <name>=<value>[; Domain=<domain_name>][; Path=<path>][; Expires=<date>][; HttpOnly][; Secure]
+// Use Cookie for SameSite, Max-Age and Partitioned attributes
 func BuildCookieHeader(name string, value string, expires *time.Time, domain string, path string, secure bool, httpOnly bool) string {
-	data := []string{}
-	data = append(data, fmt.Sprintf("%s=%s", name, value))
+	c := Cookie{Name: name, Value: value, Domain: domain, Path: path, Secure: secure, HttpOnly: httpOnly}
 	if expires != nil {
-		data = append(data, expires.UTC().String())
+		c.Expires = *expires
 	}
-	if domain != "" {
-		data = append(data, fmt.Sprintf("domain=%s", domain))
-	}
-	if path != "" {
-		data = append(data, fmt.Sprintf("path=%s", path))
-	}
-	if secure {
-		data = append(data, "secure")
-	}
-	if httpOnly {
-		data = append(data, "httponly")
-	}
-	return strings.Join(data, ";")
+	return c.String()
 }
 
 // ClientOptions http client options
@@ -98,13 +86,7 @@ func (c *Client) Get(target string, headers map[string]string, response interfac
 		return err
 	}
 	if resp.StatusCode >= 400 {
-		var r HTTPError
-		err = json.Unmarshal(body, &r)
-		if err != nil {
-			c.logger.Error(err, "failed to unmarshal response")
-			return err
-		}
-		return fmt.Errorf("[%d] %s", r.Code, r.Message)
+		return c.decodeError(resp, body)
 	} else {
 
 		err = json.Unmarshal(body, response)
@@ -145,13 +127,7 @@ func (c *Client) Post(target string, headers map[string]string, request interfac
 		return err
 	}
 	if resp.StatusCode >= 400 {
-		var r HTTPError
-		err = json.Unmarshal(body, &r)
-		if err != nil {
-			c.logger.Error(err, "failed to unmarsshal response")
-			return err
-		}
-		return fmt.Errorf("[%d] %s", r.Code, r.Message)
+		return c.decodeError(resp, body)
 	} else if resp.StatusCode == 204 { // no content
 		return nil
 	} else {
@@ -187,13 +163,7 @@ func (c *Client) Delete(target string, headers map[string]string, response inter
 		return err
 	}
 	if resp.StatusCode >= 400 {
-		var r HTTPError
-		err = json.Unmarshal(body, &r)
-		if err != nil {
-			c.logger.Error(err, "failed to unmarsshal response")
-			return err
-		}
-		return fmt.Errorf("[%d] %s", r.Code, r.Message)
+		return c.decodeError(resp, body)
 	} else {
 		err = json.Unmarshal(body, response)
 		if err != nil {
@@ -232,13 +202,7 @@ func (c *Client) Patch(target string, headers map[string]string, request interfa
 		return err
 	}
 	if resp.StatusCode >= 400 {
-		var r HTTPError
-		err = json.Unmarshal(body, &r)
-		if err != nil {
-			c.logger.Error(err, "failed to unmarsshal response")
-			return err
-		}
-		return fmt.Errorf("[%d] %s", r.Code, r.Message)
+		return c.decodeError(resp, body)
 	} else if resp.StatusCode == 204 { // no content
 		return nil
 	} else {
@@ -279,13 +243,7 @@ func (c *Client) Put(target string, headers map[string]string, request interface
 		return err
 	}
 	if resp.StatusCode >= 400 {
-		var r HTTPError
-		err = json.Unmarshal(body, &r)
-		if err != nil {
-			c.logger.Error(err, "failed to unmarsshal response")
-			return err
-		}
-		return fmt.Errorf("[%d] %s", r.Code, r.Message)
+		return c.decodeError(resp, body)
 	} else if resp.StatusCode == 204 { // no content
 		return nil
 	} else {
@@ -317,13 +275,7 @@ func (c *Client) PostForm(target string, headers map[string]string, request map[
 		return err
 	}
 	if resp.StatusCode >= 400 {
-		var r HTTPError
-		err = json.Unmarshal(body, &r)
-		if err != nil {
-			c.logger.Error(err, "failed to unmarsshal response")
-			return err
-		}
-		return fmt.Errorf("[%d] %s", r.Code, r.Message)
+		return c.decodeError(resp, body)
 	} else if resp.StatusCode == 204 { // no content
 		return nil
 	} else {
@@ -335,3 +287,24 @@ func (c *Client) PostForm(target string, headers map[string]string, request map[
 		return nil
 	}
 }
+
+// decodeError decode error response, application/problem+json is returned as *Problem
+func (c *Client) decodeError(resp *http.Response, body []byte) error {
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), ProblemContentType) {
+		var p Problem
+		if err := json.Unmarshal(body, &p); err != nil {
+			c.logger.Error(err, "failed to unmarshal problem response")
+			return err
+		}
+		if p.Status == 0 {
+			p.Status = resp.StatusCode
+		}
+		return &p
+	}
+	var r HTTPError
+	if err := json.Unmarshal(body, &r); err != nil {
+		c.logger.Error(err, "failed to unmarshal response")
+		return err
+	}
+	return fmt.Errorf("[%d] %s", r.Code, r.Message)
+}
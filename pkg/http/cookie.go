@@ -0,0 +1,395 @@
+package http
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SameSiteLax    = "Lax"
+	SameSiteStrict = "Strict"
+	SameSiteNone   = "None"
+
+	timestampSize = 8
+)
+
+var ErrInvalidCookie = errors.New("cookie is invalid")
+var ErrCookieExpired = errors.New("cookie is expired")
+
+// Cookie http cookie per RFC 6265
+type Cookie struct {
+	Name   string
+	Value  string
+	Domain string
+	Path   string
+	// Expires zero means no Expires attribute
+	Expires time.Time
+	// MaxAge seconds, 0 means no Max-Age attribute and negative means delete the cookie now
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	// SameSite Lax, Strict or None, None implies Secure
+	SameSite string
+	// Partitioned store cookie in partitioned storage of the top level site (CHIPS), implies Secure
+	Partitioned bool
+}
+
+// String Set-Cookie header value, empty if name is not a valid token or domain is not a valid domain name.
+// Invalid octets of value are dropped, Secure is set for SameSite=None and Partitioned cookies browsers reject otherwise.
+func (c Cookie) String() string {
+	if !isCookieName(c.Name) || c.Domain != "" && !isCookieDomain(c.Domain) {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteString("=")
+	b.WriteString(sanitizeCookieValue(c.Value))
+	if c.Domain != "" {
+		b.WriteString("; Domain=")
+		b.WriteString(strings.TrimPrefix(c.Domain, "."))
+	}
+	if c.Path != "" {
+		b.WriteString("; Path=")
+		b.WriteString(strings.Map(func(r rune) rune {
+			if r < 0x20 || r == 0x7f || r == ';' {
+				return -1
+			}
+			return r
+		}, c.Path))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=")
+		b.WriteString(c.Expires.UTC().Format(http.TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=")
+		b.WriteString(strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if c.Secure || c.Partitioned || strings.EqualFold(c.SameSite, SameSiteNone) {
+		b.WriteString("; Secure")
+	}
+	switch strings.ToLower(c.SameSite) {
+	case "lax":
+		b.WriteString("; SameSite=Lax")
+	case "strict":
+		b.WriteString("; SameSite=Strict")
+	case "none":
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+// SetCookie add Set-Cookie header to response
+func SetCookie(w http.ResponseWriter, c Cookie) {
+	if v := c.String(); v != "" {
+		w.Header().Add("Set-Cookie", v)
+	}
+}
+
+// ParseCookies parse Cookie request header, e.g. a=1; b="2", invalid pairs are skipped
+func ParseCookies(header string) []Cookie {
+	cookies := []Cookie{}
+	for _, part := range strings.Split(header, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		value, ok := parseCookieValue(strings.TrimSpace(value))
+		if !isCookieName(name) || !ok {
+			continue
+		}
+		cookies = append(cookies, Cookie{Name: name, Value: value})
+	}
+	return cookies
+}
+
+// ParseSetCookie parse Set-Cookie response header, unknown attributes are ignored
+func ParseSetCookie(header string) (Cookie, error) {
+	parts := strings.Split(header, ";")
+	name, value, found := strings.Cut(strings.TrimSpace(parts[0]), "=")
+	name = strings.TrimSpace(name)
+	value, ok := parseCookieValue(strings.TrimSpace(value))
+	if !found || !isCookieName(name) || !ok {
+		return Cookie{}, ErrInvalidCookie
+	}
+	c := Cookie{Name: name, Value: value}
+	for _, attr := range parts[1:] {
+		key, val, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		val = strings.TrimSpace(val)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "domain":
+			c.Domain = strings.TrimPrefix(val, ".")
+		case "path":
+			c.Path = val
+		case "expires":
+			if t, err := http.ParseTime(val); err == nil {
+				c.Expires = t
+			}
+		case "max-age":
+			if n, err := strconv.Atoi(val); err == nil {
+				if n <= 0 {
+					n = -1
+				}
+				c.MaxAge = n
+			}
+		case "secure":
+			c.Secure = true
+		case "httponly":
+			c.HttpOnly = true
+		case "samesite":
+			switch strings.ToLower(val) {
+			case "lax":
+				c.SameSite = SameSiteLax
+			case "strict":
+				c.SameSite = SameSiteStrict
+			case "none":
+				c.SameSite = SameSiteNone
+			}
+		case "partitioned":
+			c.Partitioned = true
+		}
+	}
+	return c, nil
+}
+
+// GetCookie get cookie of request by name
+func GetCookie(req *http.Request, name string) (string, bool) {
+	for _, header := range req.Header.Values("Cookie") {
+		for _, c := range ParseCookies(header) {
+			if c.Name == name {
+				return c.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+func isCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		b := name[i]
+		if b <= 0x20 || b >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?={}`, b) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isCookieDomain whether domain attribute is a host name or ip address, a leading dot is ignored
+func isCookieDomain(domain string) bool {
+	domain = strings.TrimPrefix(domain, ".")
+	if domain == "" || len(domain) > 255 {
+		return false
+	}
+	for i := 0; i < len(domain); i++ {
+		b := domain[i]
+		if !(b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '-' || b == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// isCookieOctet cookie-octet of RFC 6265
+func isCookieOctet(b byte) bool {
+	return b == 0x21 || b >= 0x23 && b <= 0x2b || b >= 0x2d && b <= 0x3a || b >= 0x3c && b <= 0x5b || b >= 0x5d && b <= 0x7e
+}
+
+func sanitizeCookieValue(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if isCookieOctet(v[i]) {
+			b.WriteByte(v[i])
+		}
+	}
+	return b.String()
+}
+
+func parseCookieValue(v string) (string, bool) {
+	if len(v) > 1 && v[0] == '"' && v[len(v)-1] == '"' {
+		v = v[1 : len(v)-1]
+	}
+	for i := 0; i < len(v); i++ {
+		if !isCookieOctet(v[i]) {
+			return "", false
+		}
+	}
+	return v, true
+}
+
+// CookieCodec protect cookie values, the cookie name is bound to the value so it can't be moved to another cookie
+type CookieCodec interface {
+	Encode(name string, value []byte) (string, error)
+	Decode(name string, encoded string) ([]byte, error)
+}
+
+// LoadCookieKeys load comma separated base64 keys from environment variable, the first key is current
+func LoadCookieKeys(envVar string) ([][]byte, error) {
+	raw := os.Getenv(envVar)
+	if raw == "" {
+		return nil, fmt.Errorf("cookie keys are not set in %s", envVar)
+	}
+	keys := [][]byte{}
+	for _, v := range strings.Split(raw, ",") {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cookie key in %s: %w", envVar, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// NewSignedCookieCodec create codec which signs values with HMAC-SHA256.
+// Values are signed by the first key and verified by any key, so keys can be rotated by prepending a new one.
+// Values older than maxAge are rejected, 0 means no limit.
+func NewSignedCookieCodec(maxAge time.Duration, keys ...[]byte) (*SignedCookieCodec, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key of signed cookie codec")
+	}
+	for _, key := range keys {
+		if len(key) < 32 {
+			return nil, fmt.Errorf("key of signed cookie codec must have at least 32 bytes")
+		}
+	}
+	return &SignedCookieCodec{keys: keys, maxAge: maxAge}, nil
+}
+
+// SignedCookieCodec HMAC signed cookie values, readable by clients
+type SignedCookieCodec struct {
+	keys   [][]byte
+	maxAge time.Duration
+}
+
+// Encode implements CookieCodec
+func (c *SignedCookieCodec) Encode(name string, value []byte) (string, error) {
+	payload := base64.RawURLEncoding.EncodeToString(timestamped(value))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.sign(c.keys[0], name, payload)), nil
+}
+
+// Decode implements CookieCodec
+func (c *SignedCookieCodec) Decode(name string, encoded string) ([]byte, error) {
+	payload, signature, found := strings.Cut(encoded, ".")
+	if !found {
+		return nil, ErrInvalidCookie
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+	for _, key := range c.keys {
+		if hmac.Equal(mac, c.sign(key, name, payload)) {
+			data, err := base64.RawURLEncoding.DecodeString(payload)
+			if err != nil {
+				return nil, ErrInvalidCookie
+			}
+			return untimestamped(data, c.maxAge)
+		}
+	}
+	return nil, ErrInvalidCookie
+}
+
+func (c *SignedCookieCodec) sign(key []byte, name string, payload string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(name + "|" + payload))
+	return h.Sum(nil)
+}
+
+// NewEncryptedCookieCodec create codec which encrypts values with AES-GCM, keys have 16, 24 or 32 bytes.
+// Values are encrypted by the first key and decrypted by any key, so keys can be rotated by prepending a new one.
+// Values older than maxAge are rejected, 0 means no limit.
+func NewEncryptedCookieCodec(maxAge time.Duration, keys ...[]byte) (*EncryptedCookieCodec, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key of encrypted cookie codec")
+	}
+	c := EncryptedCookieCodec{maxAge: maxAge}
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads = append(c.aeads, aead)
+	}
+	return &c, nil
+}
+
+// EncryptedCookieCodec AES-GCM encrypted cookie values, neither readable nor forgeable by clients
+type EncryptedCookieCodec struct {
+	aeads  []cipher.AEAD
+	maxAge time.Duration
+}
+
+// Encode implements CookieCodec
+func (c *EncryptedCookieCodec) Encode(name string, value []byte) (string, error) {
+	aead := c.aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, timestamped(value), []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decode implements CookieCodec
+func (c *EncryptedCookieCodec) Decode(name string, encoded string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+	for _, aead := range c.aeads {
+		if len(data) < aead.NonceSize() {
+			return nil, ErrInvalidCookie
+		}
+		plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+		if err == nil {
+			return untimestamped(plain, c.maxAge)
+		}
+	}
+	return nil, ErrInvalidCookie
+}
+
+// timestamped prefix value with issue time, so the codec can expire values independent of cookie expiry
+func timestamped(value []byte) []byte {
+	data := make([]byte, timestampSize, timestampSize+len(value))
+	binary.BigEndian.PutUint64(data, uint64(time.Now().Unix()))
+	return append(data, value...)
+}
+
+func untimestamped(data []byte, maxAge time.Duration) ([]byte, error) {
+	if len(data) < timestampSize {
+		return nil, ErrInvalidCookie
+	}
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(data[:timestampSize])), 0)
+	if maxAge > 0 && time.Since(issuedAt) > maxAge {
+		return nil, ErrCookieExpired
+	}
+	return data[timestampSize:], nil
+}
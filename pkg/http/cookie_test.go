@@ -0,0 +1,91 @@
+package http
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCookie(t *testing.T) {
+	expires := time.Date(2024, 5, 1, 8, 30, 0, 0, time.FixedZone("CST", 8*3600))
+	header := BuildCookieHeader("token", "abc", &expires, "example.com", "/", true, true)
+	expected := "token=abc; Domain=example.com; Path=/; Expires=Wed, 01 May 2024 00:30:00 GMT; HttpOnly; Secure"
+	if header != expected {
+		t.Fatalf("expect %s, actual %s", expected, header)
+	}
+
+	c := Cookie{Name: "id", Value: "a b;c", MaxAge: 60, SameSite: "none", Secure: true, Partitioned: true}
+	expected = "id=abc; Max-Age=60; Secure; SameSite=None; Partitioned"
+	if c.String() != expected {
+		t.Fatalf("expect %s, actual %s", expected, c.String())
+	}
+	if (Cookie{Name: "bad name", Value: "x"}).String() != "" {
+		t.Fatalf("expect invalid name is rejected")
+	}
+	if v := (Cookie{Name: "id", Value: "x", Domain: "example.com; Path=/admin"}).String(); v != "" {
+		t.Fatalf("expect invalid domain is rejected, actual %s", v)
+	}
+	if v := (Cookie{Name: "id", Value: "x", Domain: "example.com\r\nX-Injected: 1"}).String(); v != "" {
+		t.Fatalf("expect domain with line break is rejected, actual %s", v)
+	}
+	c = Cookie{Name: "id", Value: "x", SameSite: SameSiteNone}
+	if v := c.String(); v != "id=x; Secure; SameSite=None" {
+		t.Fatalf("expect Secure implied by SameSite=None, actual %s", v)
+	}
+	c = Cookie{Name: "id", Value: "x", Partitioned: true}
+	if v := c.String(); v != "id=x; Secure; Partitioned" {
+		t.Fatalf("expect Secure implied by Partitioned, actual %s", v)
+	}
+
+	parsed, err := ParseSetCookie(header + "; SameSite=Strict; Max-Age=0; Partitioned")
+	if err != nil {
+		t.Fatalf("failed to parse set-cookie %v", err)
+	}
+	if parsed.Name != "token" || parsed.Value != "abc" || !parsed.Expires.Equal(expires) || parsed.MaxAge != -1 || parsed.SameSite != SameSiteStrict || !parsed.Partitioned || !parsed.HttpOnly {
+		t.Fatalf("unexpected cookie %+v", parsed)
+	}
+	cookies := ParseCookies(`a=1; b="2"; bad name=3; c=`)
+	if len(cookies) != 3 || cookies[1].Value != "2" || cookies[2].Name != "c" {
+		t.Fatalf("unexpected cookies %+v", cookies)
+	}
+}
+
+func TestCookieCodec(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	for name, build := range map[string]func(maxAge time.Duration, keys ...[]byte) (CookieCodec, error){
+		"signed": func(maxAge time.Duration, keys ...[]byte) (CookieCodec, error) {
+			return NewSignedCookieCodec(maxAge, keys...)
+		},
+		"encrypted": func(maxAge time.Duration, keys ...[]byte) (CookieCodec, error) {
+			return NewEncryptedCookieCodec(maxAge, keys...)
+		},
+	} {
+		old, _ := build(time.Hour, oldKey)
+		rotated, err := build(time.Hour, newKey, oldKey)
+		if err != nil {
+			t.Fatalf("%s: failed to create codec %v", name, err)
+		}
+		encoded, _ := old.Encode("session", []byte("user-1"))
+		if value, err := rotated.Decode("session", encoded); err != nil || string(value) != "user-1" {
+			t.Fatalf("%s: expect value of old key decoded after rotation, actual %s %v", name, value, err)
+		}
+		if _, err := rotated.Decode("other", encoded); err != ErrInvalidCookie {
+			t.Fatalf("%s: expect value bound to cookie name, actual %v", name, err)
+		}
+		if _, err := rotated.Decode("session", encoded[:len(encoded)-2]+"xx"); err != ErrInvalidCookie {
+			t.Fatalf("%s: expect tampered value rejected, actual %v", name, err)
+		}
+		encoded, _ = rotated.Encode("session", []byte("user-1"))
+		if _, err := old.Decode("session", encoded); err != ErrInvalidCookie {
+			t.Fatalf("%s: expect value of new key unknown to old codec, actual %v", name, err)
+		}
+		expiring, _ := build(-time.Second, newKey)
+		if expiring != nil {
+			encoded, _ = expiring.Encode("session", []byte("user-1"))
+			if _, err := expiring.Decode("session", encoded); err != nil {
+				t.Fatalf("%s: expect negative max age means no limit, actual %v", name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-logr/logr"
+)
+
+const (
+	CSRFModeDoubleSubmit = "double-submit"
+	CSRFModeSession      = "session"
+
+	csrfKey              = "peach.csrf"
+	csrfSessionKey       = "csrf_token"
+	csrfTokenSize        = 32
+	defaultCSRFCookie    = "csrf_token"
+	defaultCSRFHeader    = "X-CSRF-Token"
+	defaultCSRFFormField = "csrf_token"
+)
+
+var ErrCSRFTokenInvalid = errors.New("csrf token is missing or invalid")
+
+// CSRFOptions csrf middleware options
+type CSRFOptions struct {
+	// Mode double-submit keeps the token in a cookie readable by scripts, session keeps it in the session (synchronizer token), default double-submit
+	Mode string `json:"mode" yaml:"mode"`
+	// CookieName cookie of double-submit token, default csrf_token
+	CookieName string `json:"cookieName" yaml:"cookieName"`
+	// HeaderName request header carries the token, also set on responses of safe requests, default X-CSRF-Token
+	HeaderName string `json:"headerName" yaml:"headerName"`
+	// FormField form field carries the token, default csrf_token
+	FormField string `json:"formField" yaml:"formField"`
+	Domain    string `json:"domain" yaml:"domain"`
+	// Path cookie path, default /
+	Path   string `json:"path" yaml:"path"`
+	Secure bool   `json:"secure" yaml:"secure"`
+	// SameSite Lax, Strict or None, default Lax
+	SameSite string `json:"sameSite" yaml:"sameSite"`
+	// ExemptPaths paths never checked, e.g. webhooks verified by signature
+	ExemptPaths []string `json:"exemptPaths" yaml:"exemptPaths"`
+	// KeysEnvVar environment variable holds comma separated base64 keys signing the double-submit cookie, the first key is current
+	KeysEnvVar string `json:"keysEnvVar" yaml:"keysEnvVar"`
+}
+
+// BuildCSRFMiddleware create csrf middleware, the double-submit cookie is signed by keys of KeysEnvVar
+func BuildCSRFMiddleware(options CSRFOptions, logger *logr.Logger) (gin.HandlerFunc, error) {
+	if options.Mode == CSRFModeSession {
+		return NewCSRFMiddleware(options, nil, logger), nil
+	}
+	if options.KeysEnvVar == "" {
+		return nil, fmt.Errorf("keysEnvVar of csrf is missing")
+	}
+	keys, err := LoadCookieKeys(options.KeysEnvVar)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := NewSignedCookieCodec(0, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return NewCSRFMiddleware(options, codec, logger), nil
+}
+
+// NewCSRFMiddleware create middleware which rejects unsafe requests without the csrf token of the client with 403.
+// The double-submit cookie is signed by codec together with the authenticated principal, so a cookie issued to another client,
+// e.g. planted by a sibling domain, is rejected for authenticated requests. Tokens of anonymous clients are not bound to
+// anyone, use session mode to bind them to the session. codec is not used in session mode.
+// Requests authenticated by a bearer token are exempt, browsers never attach it by themselves, so the middleware must run after
+// the auth middleware. Session mode requires the session middleware to run before.
+func NewCSRFMiddleware(options CSRFOptions, codec CookieCodec, logger *logr.Logger) gin.HandlerFunc {
+	if options.Mode == "" {
+		options.Mode = CSRFModeDoubleSubmit
+	}
+	if options.CookieName == "" {
+		options.CookieName = defaultCSRFCookie
+	}
+	if options.HeaderName == "" {
+		options.HeaderName = defaultCSRFHeader
+	}
+	if options.FormField == "" {
+		options.FormField = defaultCSRFFormField
+	}
+	if options.Path == "" {
+		options.Path = "/"
+	}
+	if options.SameSite == "" {
+		options.SameSite = SameSiteLax
+	}
+	return func(gc *gin.Context) {
+		if isExempt(options.ExemptPaths, gc.Request.URL.Path) || bearerAuthenticated(gc) {
+			gc.Next()
+			return
+		}
+		token, err := csrfToken(gc, options, codec)
+		if err != nil {
+			logger.Error(err, "failed to get csrf token")
+			abortWithError(gc, http.StatusInternalServerError, err)
+			return
+		}
+		gc.Set(csrfKey, csrfContext{token: token, field: options.FormField})
+		switch gc.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			gc.Header(options.HeaderName, maskCSRFToken(token))
+			gc.Next()
+			return
+		}
+		sent := gc.GetHeader(options.HeaderName)
+		if sent == "" {
+			sent = gc.PostForm(options.FormField)
+		}
+		if !validCSRFToken(token, sent) {
+			logger.V(1).Info("csrf token is rejected", "path", gc.Request.URL.Path, "client", gc.ClientIP())
+			abortWithError(gc, http.StatusForbidden, ErrCSRFTokenInvalid)
+			return
+		}
+		gc.Next()
+	}
+}
+
+// bearerAuthenticated whether the request is authenticated by its bearer token
+func bearerAuthenticated(gc *gin.Context) bool {
+	p, ok := GetPrincipal(gc)
+	return ok && p.Method == "jwt" && bearerToken(gc.Request) != ""
+}
+
+type csrfContext struct {
+	token []byte
+	field string
+}
+
+// csrfToken get token of client, a new one is issued if missing or the cookie is not signed by codec for the principal
+func csrfToken(gc *gin.Context, options CSRFOptions, codec CookieCodec) ([]byte, error) {
+	if options.Mode == CSRFModeSession {
+		s := GetSession(gc)
+		if s == nil {
+			return nil, fmt.Errorf("csrf session mode requires session middleware")
+		}
+		if token, err := base64.RawURLEncoding.DecodeString(s.GetString(csrfSessionKey)); err == nil && len(token) == csrfTokenSize {
+			return token, nil
+		}
+		token, err := newCSRFToken()
+		if err != nil {
+			return nil, err
+		}
+		s.Set(csrfSessionKey, base64.RawURLEncoding.EncodeToString(token))
+		return token, nil
+	}
+	if codec == nil {
+		return nil, fmt.Errorf("csrf double-submit mode requires cookie codec")
+	}
+	name := csrfCookieBinding(gc, options.CookieName)
+	if value, ok := GetCookie(gc.Request, options.CookieName); ok {
+		if token, err := codec.Decode(name, value); err == nil && len(token) == csrfTokenSize {
+			return token, nil
+		}
+	}
+	token, err := newCSRFToken()
+	if err != nil {
+		return nil, err
+	}
+	value, err := codec.Encode(name, token)
+	if err != nil {
+		return nil, err
+	}
+	// readable by scripts, which send the token of the response header back
+	SetCookie(gc.Writer, Cookie{Name: options.CookieName, Value: value, Domain: options.Domain, Path: options.Path, Secure: options.Secure, SameSite: options.SameSite})
+	return token, nil
+}
+
+// csrfCookieBinding name the double-submit cookie is signed with, it includes the principal so a token is only valid for its client
+func csrfCookieBinding(gc *gin.Context, cookie string) string {
+	if p, ok := GetPrincipal(gc); ok {
+		return cookie + "\x00" + p.Method + ":" + p.Subject
+	}
+	return cookie
+}
+
+func newCSRFToken() ([]byte, error) {
+	token := make([]byte, csrfTokenSize)
+	_, err := rand.Read(token)
+	return token, err
+}
+
+// maskCSRFToken xor token with a one time pad, so the token embedded in compressed pages differs every time (BREACH)
+func maskCSRFToken(token []byte) string {
+	masked := make([]byte, 2*len(token))
+	pad := masked[:len(token)]
+	if _, err := rand.Read(pad); err != nil {
+		return base64.RawURLEncoding.EncodeToString(token)
+	}
+	for i := range token {
+		masked[len(token)+i] = pad[i] ^ token[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// validCSRFToken compare sent token, masked or plain, with the token of client
+func validCSRFToken(token []byte, sent string) bool {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(sent))
+	if err != nil {
+		return false
+	}
+	if len(data) == 2*csrfTokenSize {
+		for i := 0; i < csrfTokenSize; i++ {
+			data[csrfTokenSize+i] ^= data[i]
+		}
+		data = data[csrfTokenSize:]
+	}
+	return len(data) == csrfTokenSize && subtle.ConstantTimeCompare(data, token) == 1
+}
+
+// CSRFToken masked csrf token of request for forms or headers, empty if csrf middleware is not installed
+func CSRFToken(gc *gin.Context) string {
+	v, ok := gc.Get(csrfKey)
+	if !ok {
+		return ""
+	}
+	return maskCSRFToken(v.(csrfContext).token)
+}
+
+// CSRFField hidden form input carrying the csrf token
+func CSRFField(gc *gin.Context) template.HTML {
+	v, ok := gc.Get(csrfKey)
+	if !ok {
+		return ""
+	}
+	c := v.(csrfContext)
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, template.HTMLEscapeString(c.field), maskCSRFToken(c.token)))
+}
+
+// CSRFFuncMap template functions, register with engine.SetFuncMap and pass the gin context to templates, e.g. {{ csrfField .ctx }}
+func CSRFFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": CSRFToken,
+		"csrfField": CSRFField,
+	}
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/af-go/peach-common/pkg/log"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	codec, _ := NewSignedCookieCodec(0, bytes.Repeat([]byte{1}, 32))
+	for _, mode := range []string{CSRFModeDoubleSubmit, CSRFModeSession} {
+		r := gin.New()
+		r.SetHTMLTemplate(template.Must(template.New("form").Funcs(CSRFFuncMap()).Parse(`<form method="post">{{ csrfField .ctx }}</form>`)))
+		if mode == CSRFModeSession {
+			r.Use(NewSessionMiddleware(SessionOptions{}, codec, NewMemorySessionStore(), log.NewLogger(false)))
+		}
+		r.Use(func(gc *gin.Context) {
+			if bearerToken(gc.Request) == "api-token" {
+				gc.Set(principalKey, &Principal{Subject: "ci", Method: "jwt"})
+			} else if user := gc.GetHeader("X-User"); user != "" {
+				gc.Set(principalKey, &Principal{Subject: user, Method: "basic"})
+			}
+		})
+		r.Use(NewCSRFMiddleware(CSRFOptions{Mode: mode}, codec, log.NewLogger(false)))
+		r.GET("/form", func(gc *gin.Context) {
+			gc.HTML(http.StatusOK, "form", gin.H{"ctx": gc})
+		})
+		r.POST("/form", func(gc *gin.Context) {
+			gc.String(http.StatusOK, "saved")
+		})
+		do := func(req *http.Request, cookies []string) *httptest.ResponseRecorder {
+			req.Header.Set("Cookie", strings.Join(cookies, "; "))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		w := do(httptest.NewRequest(http.MethodGet, "/form", nil), nil)
+		cookies := []string{}
+		for _, v := range w.Header().Values("Set-Cookie") {
+			c, _ := ParseSetCookie(v)
+			cookies = append(cookies, c.Name+"="+c.Value)
+		}
+		m := regexp.MustCompile(`name="csrf_token" value="([^"]+)"`).FindStringSubmatch(w.Body.String())
+		if m == nil || w.Header().Get("X-CSRF-Token") == "" || len(cookies) != 1 {
+			t.Fatalf("%s: expect token in form, header and one cookie, actual %s %v", mode, w.Body.String(), w.Header())
+		}
+
+		form := url.Values{"csrf_token": {m[1]}}
+		req := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if w := do(req, cookies); w.Code != http.StatusOK {
+			t.Fatalf("%s: expect form with token accepted, actual %d", mode, w.Code)
+		}
+		req = httptest.NewRequest(http.MethodPost, "/form", nil)
+		req.Header.Set("X-CSRF-Token", w.Header().Get("X-CSRF-Token"))
+		if w := do(req, cookies); w.Code != http.StatusOK {
+			t.Fatalf("%s: expect header with token accepted, actual %d", mode, w.Code)
+		}
+		if w := do(httptest.NewRequest(http.MethodPost, "/form", nil), cookies); w.Code != http.StatusForbidden {
+			t.Fatalf("%s: expect request without token rejected, actual %d", mode, w.Code)
+		}
+		req = httptest.NewRequest(http.MethodPost, "/form", nil)
+		req.Header.Set("X-CSRF-Token", m[1])
+		if w := do(req, nil); w.Code != http.StatusForbidden {
+			t.Fatalf("%s: expect token of another client rejected, actual %d", mode, w.Code)
+		}
+		req = httptest.NewRequest(http.MethodPost, "/form", nil)
+		req.Header.Set("Authorization", "Bearer api-token")
+		if w := do(req, nil); w.Code != http.StatusOK {
+			t.Fatalf("%s: expect authenticated bearer request exempt, actual %d", mode, w.Code)
+		}
+		req = httptest.NewRequest(http.MethodPost, "/form", nil)
+		req.Header.Set("Authorization", "Bearer forged")
+		if w := do(req, nil); w.Code != http.StatusForbidden {
+			t.Fatalf("%s: expect unauthenticated bearer request checked, actual %d", mode, w.Code)
+		}
+		if mode == CSRFModeDoubleSubmit {
+			planted := base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{7}, csrfTokenSize))
+			req = httptest.NewRequest(http.MethodPost, "/form", nil)
+			req.Header.Set("X-CSRF-Token", planted)
+			if w := do(req, []string{"csrf_token=" + planted}); w.Code != http.StatusForbidden {
+				t.Fatalf("expect unsigned cookie rejected, actual %d", w.Code)
+			}
+			// a signed cookie issued to the attacker is planted for a victim
+			req = httptest.NewRequest(http.MethodGet, "/form", nil)
+			req.Header.Set("X-User", "mallory")
+			w := do(req, nil)
+			c, _ := ParseSetCookie(w.Header().Get("Set-Cookie"))
+			req = httptest.NewRequest(http.MethodPost, "/form", nil)
+			req.Header.Set("X-User", "mallory")
+			req.Header.Set("X-CSRF-Token", w.Header().Get("X-CSRF-Token"))
+			if w := do(req, []string{"csrf_token=" + c.Value}); w.Code != http.StatusOK {
+				t.Fatalf("expect token of principal accepted, actual %d", w.Code)
+			}
+			req = httptest.NewRequest(http.MethodPost, "/form", nil)
+			req.Header.Set("X-User", "alice")
+			req.Header.Set("X-CSRF-Token", w.Header().Get("X-CSRF-Token"))
+			if w := do(req, []string{"csrf_token=" + c.Value}); w.Code != http.StatusForbidden {
+				t.Fatalf("expect token of another principal rejected, actual %d", w.Code)
+			}
+		}
+	}
+}
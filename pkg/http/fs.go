@@ -0,0 +1,240 @@
+package http
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultIndexFile       = "index.html"
+	defaultImmutableMaxAge = 365 * 24 * 60 * 60
+)
+
+// FSOptions file system handler options
+type FSOptions struct {
+	// SPA serve the index file for unknown paths without extension, so client side routes resolve
+	SPA bool `json:"spa" yaml:"spa"`
+	// Index index file of directories, default index.html
+	Index string `json:"index" yaml:"index"`
+	// EnableListing list directories without index file, disabled by default
+	EnableListing bool `json:"enableListing" yaml:"enableListing"`
+	// ImmutablePattern regular expression of hashed asset names cached forever, default matches names like app.3f9a2c1b.js or index-BkD8s3x1.css
+	ImmutablePattern string `json:"immutablePattern" yaml:"immutablePattern"`
+	// MaxAge seconds hashed assets are cached, default one year
+	MaxAge int `json:"maxAge" yaml:"maxAge"`
+}
+
+var hashSegmentPattern = regexp.MustCompile(`[.-]([0-9A-Za-z_]{8,})\.[0-9A-Za-z]+$`)
+
+// isHashed whether name carries a content hash, e.g. app.3f9a2c1b.js, the hash must contain a digit
+func isHashed(name string) bool {
+	m := hashSegmentPattern.FindStringSubmatch(name)
+	return m != nil && strings.ContainsAny(m[1], "0123456789")
+}
+
+func NewSimpleFSHandler(fsPath string, relativePath string) *SimpleFSHandler {
+	// default options never fail
+	h, _ := NewFSHandler(os.DirFS(fsPath), relativePath, FSOptions{})
+	return h
+}
+
+// NewFSHandler create handler serving any fs.FS, including embed.FS, under relativePath, an invalid ImmutablePattern is an error
+func NewFSHandler(fsys fs.FS, relativePath string, options FSOptions) (*SimpleFSHandler, error) {
+	if options.Index == "" {
+		options.Index = defaultIndexFile
+	}
+	if options.MaxAge <= 0 {
+		options.MaxAge = defaultImmutableMaxAge
+	}
+	immutable := isHashed
+	if options.ImmutablePattern != "" {
+		pattern, err := regexp.Compile(options.ImmutablePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid immutable pattern: %w", err)
+		}
+		immutable = pattern.MatchString
+	}
+	return &SimpleFSHandler{fsys: fsys, relativePath: relativePath, options: options, immutable: immutable}, nil
+}
+
+type SimpleFSHandler struct {
+	relativePath string
+	fsys         fs.FS
+	options      FSOptions
+	immutable    func(name string) bool
+}
+
+// Build build file system handler
+func (f *SimpleFSHandler) Build(engine *gin.Engine) {
+	urlPattern := path.Join(f.relativePath, "/*filepath")
+	engine.GET(urlPattern, f.serve)
+	engine.HEAD(urlPattern, f.serve)
+}
+
+func (f *SimpleFSHandler) serve(gc *gin.Context) {
+	name := strings.TrimPrefix(path.Clean("/"+gc.Param("filepath")), "/")
+	if name == "" {
+		name = "."
+	}
+	info, err := fs.Stat(f.fsys, name)
+	if err == nil && info.IsDir() {
+		index := path.Join(name, f.options.Index)
+		if _, err := fs.Stat(f.fsys, index); err == nil {
+			f.serveFile(gc, index)
+			return
+		}
+		if f.options.EnableListing {
+			f.list(gc, name)
+			return
+		}
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && f.options.SPA && path.Ext(name) == "" {
+			f.serveFile(gc, f.options.Index)
+			return
+		}
+		gc.Status(http.StatusNotFound)
+		return
+	}
+	f.serveFile(gc, name)
+}
+
+// serveFile serve precompressed variant when the client accepts it, set strong etag and cache headers
+func (f *SimpleFSHandler) serveFile(gc *gin.Context, name string) {
+	served := name
+	encoding := ""
+	accept := gc.GetHeader("Accept-Encoding")
+	for _, v := range []struct{ encoding, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if !acceptsEncoding(accept, v.encoding) {
+			continue
+		}
+		if info, err := fs.Stat(f.fsys, name+v.ext); err == nil && !info.IsDir() {
+			served = name + v.ext
+			encoding = v.encoding
+			break
+		}
+	}
+	file, content, info, err := f.open(served)
+	if err != nil {
+		gc.Status(http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	tag := etag(served, info)
+	if encoding != "" {
+		gc.Header("Content-Encoding", encoding)
+	}
+	gc.Header("Vary", "Accept-Encoding")
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		gc.Header("Content-Type", ct)
+	}
+	gc.Header("ETag", tag)
+	if f.immutable(path.Base(name)) {
+		gc.Header("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", f.options.MaxAge))
+	} else {
+		gc.Header("Cache-Control", "no-cache")
+	}
+	http.ServeContent(gc.Writer, gc.Request, name, info.ModTime(), content)
+}
+
+// open open regular file as io.ReadSeeker, so it is streamed and ranges are served without reading it into memory.
+// Files of fs.FS implementations which can't seek are read into memory.
+func (f *SimpleFSHandler) open(name string) (fs.File, io.ReadSeeker, fs.FileInfo, error) {
+	file, err := f.fsys.Open(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, nil, nil, fs.ErrNotExist
+	}
+	if rs, ok := file.(io.ReadSeeker); ok {
+		return file, rs, info, nil
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, nil, err
+	}
+	return file, bytes.NewReader(content), info, nil
+}
+
+// etagEpoch stands in for the modification time of files without one, e.g. of embed.FS, which only change with the binary
+var etagEpoch = time.Now()
+
+// etag etag of file derived from its name, modification time and size, so files are never read to tag them
+func etag(name string, info fs.FileInfo) string {
+	modTime := info.ModTime()
+	if modTime.IsZero() {
+		modTime = etagEpoch
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d", name, modTime.UnixNano(), info.Size())))
+	return fmt.Sprintf("%q", hex.EncodeToString(sum[:16]))
+}
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{ .Dir }}</title></head>
+<body><pre>
+{{ range .Entries }}<a href="{{ . }}">{{ . }}</a>
+{{ end }}</pre></body></html>
+`))
+
+func (f *SimpleFSHandler) list(gc *gin.Context, name string) {
+	if !strings.HasSuffix(gc.Request.URL.Path, "/") {
+		gc.Redirect(http.StatusMovedPermanently, gc.Request.URL.Path+"/")
+		return
+	}
+	entries, err := fs.ReadDir(f.fsys, name)
+	if err != nil {
+		gc.Status(http.StatusNotFound)
+		return
+	}
+	names := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name()+"/")
+		} else {
+			names = append(names, e.Name())
+		}
+	}
+	gc.Header("Content-Type", "text/html; charset=utf-8")
+	gc.Status(http.StatusOK)
+	_ = listingTemplate.Execute(gc.Writer, map[string]interface{}{"Dir": name, "Entries": names})
+}
+
+func acceptsEncoding(header string, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(fields[0]) != encoding {
+			continue
+		}
+		for _, p := range fields[1:] {
+			if q := strings.TrimSpace(p); q == "q=0" || q == "q=0.0" || q == "q=0.00" || q == "q=0.000" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestFSHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":                {Data: []byte("<h1>app</h1>")},
+		"assets/app.3f9a2c1b.js":    {Data: []byte("console.log('plain')")},
+		"assets/app.3f9a2c1b.js.gz": {Data: []byte("gzipped")},
+		"assets/app.3f9a2c1b.js.br": {Data: []byte("brotli")},
+		"assets/logo.svg":           {Data: []byte("<svg/>")},
+		"docs/readme.txt":           {Data: []byte("readme")},
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h, err := NewFSHandler(fsys, "/ui", FSOptions{SPA: true})
+	if err != nil {
+		t.Fatalf("failed to create fs handler %v", err)
+	}
+	h.Build(r)
+
+	do := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/ui/assets/app.3f9a2c1b.js", map[string]string{"Accept-Encoding": "gzip, br"})
+	if w.Body.String() != "brotli" || w.Header().Get("Content-Encoding") != "br" {
+		t.Fatalf("expect brotli variant, actual %q %q", w.Body.String(), w.Header().Get("Content-Encoding"))
+	}
+	if w.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Fatalf("unexpected cache control %q", w.Header().Get("Cache-Control"))
+	}
+	w = do("/ui/assets/app.3f9a2c1b.js", map[string]string{"Accept-Encoding": "gzip, br;q=0"})
+	if w.Body.String() != "gzipped" {
+		t.Fatalf("expect gzip variant, actual %q", w.Body.String())
+	}
+	w = do("/ui/assets/logo.svg", nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" || w.Header().Get("Cache-Control") != "no-cache" || w.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+	if w = do("/ui/assets/logo.svg", map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Fatalf("expect 304, actual %d", w.Code)
+	}
+	fsys["assets/logo.svg"] = &fstest.MapFile{Data: []byte("<svg/>"), ModTime: time.Now()}
+	if w = do("/ui/assets/logo.svg", map[string]string{"If-None-Match": etag}); w.Code != 200 || w.Header().Get("ETag") == etag {
+		t.Fatalf("expect new etag for modified file, actual %d %v", w.Code, w.Header())
+	}
+	if w = do("/ui/docs/readme.txt", map[string]string{"Range": "bytes=2-4"}); w.Code != http.StatusPartialContent || w.Body.String() != "adm" {
+		t.Fatalf("expect range served, actual %d %q", w.Code, w.Body.String())
+	}
+	if w = do("/ui/dashboard/settings", nil); w.Code != 200 || w.Body.String() != "<h1>app</h1>" {
+		t.Fatalf("expect spa fallback, actual %d %q", w.Code, w.Body.String())
+	}
+	if w = do("/ui/missing.js", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expect 404 for missing asset, actual %d", w.Code)
+	}
+	if w = do("/ui/docs/", nil); w.Body.String() != "<h1>app</h1>" {
+		t.Fatalf("expect spa fallback instead of directory listing, actual %d %q", w.Code, w.Body.String())
+	}
+	if _, err := NewFSHandler(fsys, "/ui", FSOptions{ImmutablePattern: "("}); err == nil {
+		t.Fatalf("expect error for invalid immutable pattern")
+	}
+}
@@ -7,6 +7,15 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+var healthzRoute = Route{
+	Method:      http.MethodGet,
+	Path:        "/healthz",
+	Summary:     "health check",
+	Description: "check status",
+	Tags:        []string{"health"},
+	Response:    StatusResponse{},
+}
+
 func NewDummyHealthyHandler() *DummyHealthyHandler {
 	return &DummyHealthyHandler{}
 }
@@ -20,13 +29,16 @@ func (h *DummyHealthyHandler) Build(engine *gin.Engine) {
 	engine.GET("/healthz", h.Healthz)
 }
 
+// Routes implements Describer
+func (h *DummyHealthyHandler) Routes() []Route {
+	return []Route{healthzRoute}
+}
+
 // Healthz health check api
 // @Produce json
 // @Summary health check
 // @Description check status
 // @Success 200 {object} StatusResponse
-// @Failure 400 {object} TTPError
-// @Failure 503 {object} HTTPError
 // @Router /healthz [get]
 func (h *DummyHealthyHandler) Healthz(gc *gin.Context) {
 	statusCode := 200
@@ -34,20 +46,6 @@ func (h *DummyHealthyHandler) Healthz(gc *gin.Context) {
 	gc.JSON(statusCode, &resp)
 }
 
-func NewSimpleFSHandler(fsPath string, relativePath string) *SimpleFSHandler {
-	return &SimpleFSHandler{fsPath: fsPath, relativePath: relativePath}
-}
-
-type SimpleFSHandler struct {
-	relativePath string
-	fsPath       string
-}
-
-// Build build health check handler
-func (f *SimpleFSHandler) Build(engine *gin.Engine) {
-	engine.StaticFS(f.relativePath, http.Dir(f.fsPath))
-}
-
 func NewSimpleHealthyHandler() *SimpleHealthyHandler {
 	return &SimpleHealthyHandler{}
 }
@@ -61,13 +59,16 @@ func (h *SimpleHealthyHandler) Build(engine *gin.Engine) {
 	engine.GET("/healthz", h.Healthz)
 }
 
+// Routes implements Describer
+func (h *SimpleHealthyHandler) Routes() []Route {
+	return []Route{healthzRoute}
+}
+
 // Healthz health check api
 // @Produce json
 // @Summary health check
 // @Description check status
 // @Success 200 {object} StatusResponse
-// @Failure 400 {object} TTPError
-// @Failure 503 {object} HTTPError
 // @Router /healthz [get]
 func (h *SimpleHealthyHandler) Healthz(gc *gin.Context) {
 	statusCode := 200
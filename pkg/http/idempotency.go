@@ -0,0 +1,318 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	model "github.com/af-go/peach-common/pkg/model/database"
+	"github.com/gin-gonic/gin"
+	"github.com/go-logr/logr"
+)
+
+const (
+	defaultIdempotencyHeader       = "Idempotency-Key"
+	defaultIdempotencyTTL          = 24 * 60 * 60
+	defaultIdempotencyLockTimeout  = 60
+	defaultIdempotencyMaxBodyBytes = 1 << 20
+	maxIdempotencyKeyLength        = 255
+
+	IdempotencyStoreMemory = "memory"
+	IdempotencyStoreMySQL  = "mysql"
+)
+
+var ErrIdempotencyKeyInvalid = errors.New("idempotency key is invalid")
+var ErrIdempotencyKeyRequired = errors.New("idempotency key is required")
+var ErrIdempotencyInFlight = errors.New("request with the same idempotency key is in progress")
+var ErrIdempotencyKeyReused = errors.New("idempotency key is reused with a different request")
+var ErrIdempotencyBodyTooLarge = errors.New("request body is too large for an idempotency key")
+
+// idempotencyExcludedHeaders response headers of one client, not replayed to retries
+var idempotencyExcludedHeaders = []string{"Set-Cookie", "Date", "Content-Length", defaultCSRFHeader}
+
+// IdempotencyOptions idempotency middleware options
+type IdempotencyOptions struct {
+	// Header request header holds the key, default Idempotency-Key
+	Header string `json:"header" yaml:"header"`
+	// Methods methods honouring the key, default POST and PATCH
+	Methods []string `json:"methods" yaml:"methods"`
+	// Required reject requests of Methods without key with 400
+	Required bool `json:"required" yaml:"required"`
+	// TTL seconds a completed response is replayed, default one day
+	TTL int `json:"ttl" yaml:"ttl"`
+	// LockTimeout seconds a key is held by an unfinished request, e.g. of a crashed instance, default 60
+	LockTimeout int `json:"lockTimeout" yaml:"lockTimeout"`
+	// Store memory or mysql, default memory
+	Store string `json:"store" yaml:"store"`
+	// MySQL database of mysql store
+	MySQL *model.MySQLOptions `json:"mysql,omitempty" yaml:"mysql,omitempty"`
+	// Table table of mysql store, default idempotency_keys
+	Table string `json:"table" yaml:"table"`
+	// MaxBodyBytes max size of request bodies with a key, larger ones are rejected with 413, default 1MB
+	MaxBodyBytes int64 `json:"maxBodyBytes" yaml:"maxBodyBytes"`
+}
+
+// IdempotencyRecord request reserved or completed with an idempotency key
+type IdempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Completed   bool        `json:"completed"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+	ExpiresAt   time.Time   `json:"expiresAt"`
+}
+
+// IdempotencyStore storage of idempotency records, shared by all instances for keys to hold across them
+type IdempotencyStore interface {
+	// Reserve reserve key until ttl for a new request, or return the unexpired record of key reserved before
+	Reserve(ctx context.Context, key string, fingerprint string, ttl time.Duration) (existing *IdempotencyRecord, err error)
+	// Complete save response of reserved key, replayed until ttl
+	Complete(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error
+	// Release remove key so the request can be retried, e.g. it failed with 5xx
+	Release(ctx context.Context, key string) error
+}
+
+// BuildIdempotencyStore create store by options
+func BuildIdempotencyStore(options IdempotencyOptions) (IdempotencyStore, error) {
+	switch options.Store {
+	case "", IdempotencyStoreMemory:
+		return NewMemoryIdempotencyStore(), nil
+	case IdempotencyStoreMySQL:
+		if options.MySQL == nil {
+			return nil, fmt.Errorf("mysql options of idempotency store are missing")
+		}
+		return NewMySQLIdempotencyStore(*options.MySQL, options.Table)
+	}
+	return nil, fmt.Errorf("unknown idempotency store %s", options.Store)
+}
+
+// NewIdempotencyMiddleware create middleware which stores the first response of a request with idempotency key and replays it on retries.
+// Keys are scoped by authenticated principal, so it should run after the auth middleware.
+// Keys of anonymous requests are ignored, they could not be told apart from keys of other clients.
+// Concurrent duplicates are rejected with 409, a key reused with different method, path or body with 422.
+// Responses with 5xx are not stored, the request can be retried with the same key.
+func NewIdempotencyMiddleware(options IdempotencyOptions, store IdempotencyStore, logger *logr.Logger) gin.HandlerFunc {
+	if options.Header == "" {
+		options.Header = defaultIdempotencyHeader
+	}
+	if len(options.Methods) == 0 {
+		options.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if options.TTL <= 0 {
+		options.TTL = defaultIdempotencyTTL
+	}
+	if options.LockTimeout <= 0 {
+		options.LockTimeout = defaultIdempotencyLockTimeout
+	}
+	if options.MaxBodyBytes <= 0 {
+		options.MaxBodyBytes = defaultIdempotencyMaxBodyBytes
+	}
+	ttl := time.Duration(options.TTL) * time.Second
+	lockTimeout := time.Duration(options.LockTimeout) * time.Second
+	return func(gc *gin.Context) {
+		if !contains(options.Methods, gc.Request.Method) {
+			gc.Next()
+			return
+		}
+		key := gc.GetHeader(options.Header)
+		if key == "" {
+			if options.Required {
+				abortWithError(gc, http.StatusBadRequest, ErrIdempotencyKeyRequired)
+				return
+			}
+			gc.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abortWithError(gc, http.StatusBadRequest, ErrIdempotencyKeyInvalid)
+			return
+		}
+		p, ok := GetPrincipal(gc)
+		if !ok {
+			gc.Next()
+			return
+		}
+		body, ok, err := readBody(gc.Request, options.MaxBodyBytes)
+		if err != nil {
+			abortWithError(gc, http.StatusBadRequest, err)
+			return
+		}
+		if !ok {
+			abortWithError(gc, http.StatusRequestEntityTooLarge, ErrIdempotencyBodyTooLarge)
+			return
+		}
+		key = idempotencyKey(p.Method+":"+p.Subject, key)
+		fingerprint := requestFingerprint(gc.Request, body)
+		existing, err := store.Reserve(gc, key, fingerprint, lockTimeout)
+		if err != nil {
+			logger.Error(err, "failed to reserve idempotency key")
+			RenderError(gc, err)
+			gc.Abort()
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				abortWithError(gc, http.StatusUnprocessableEntity, ErrIdempotencyKeyReused)
+			case !existing.Completed:
+				abortWithError(gc, http.StatusConflict, ErrIdempotencyInFlight)
+			default:
+				replay(gc, existing)
+			}
+			return
+		}
+
+		w := &capturingWriter{ResponseWriter: gc.Writer}
+		gc.Writer = w
+		completed := false
+		defer func() {
+			// release key of panicked request, otherwise it is locked until LockTimeout
+			if !completed {
+				if err := store.Release(context.Background(), key); err != nil {
+					logger.Error(err, "failed to release idempotency key")
+				}
+			}
+		}()
+		gc.Next()
+		gc.Writer = w.ResponseWriter
+		if status := w.Status(); status >= http.StatusInternalServerError {
+			return
+		}
+		header := w.Header().Clone()
+		for _, k := range idempotencyExcludedHeaders {
+			header.Del(k)
+		}
+		record := IdempotencyRecord{Fingerprint: fingerprint, Completed: true, Status: w.Status(), Header: header, Body: w.body.Bytes()}
+		if err := store.Complete(context.Background(), key, record, ttl); err != nil {
+			logger.Error(err, "failed to save idempotent response")
+			return
+		}
+		completed = true
+	}
+}
+
+func replay(gc *gin.Context, record *IdempotencyRecord) {
+	for k, values := range record.Header {
+		for _, v := range values {
+			gc.Writer.Header().Add(k, v)
+		}
+	}
+	gc.Header("Idempotent-Replayed", "true")
+	gc.Status(record.Status)
+	if len(record.Body) > 0 {
+		_, _ = gc.Writer.Write(record.Body)
+	}
+	gc.Abort()
+}
+
+// idempotencyKey key of store, hashed so any key fits in the mysql column
+func idempotencyKey(scope string, key string) string {
+	sum := sha256.Sum256([]byte(scope + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+func requestFingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.RequestURI() + "\x00"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// readBody read body up to limit bytes and restore it for handlers, ok is false if the body is larger than limit
+func readBody(req *http.Request, limit int64) (body []byte, ok bool, err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	body, err = io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		// handlers still read the whole body
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, false, nil
+	}
+	_ = req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true, nil
+}
+
+// capturingWriter copy response body while writing it to client
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// NewMemoryIdempotencyStore create in-memory store, keys only hold within one instance
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]IdempotencyRecord)}
+}
+
+// MemoryIdempotencyStore in-memory idempotency store, expired records are removed on write
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]IdempotencyRecord
+	lastSweep time.Time
+}
+
+// Reserve implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Reserve(_ context.Context, key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	if r, ok := s.records[key]; ok && now.Before(r.ExpiresAt) {
+		return &r, nil
+	}
+	s.records[key] = IdempotencyRecord{Fingerprint: fingerprint, ExpiresAt: now.Add(ttl)}
+	return nil, nil
+}
+
+// Complete implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record.ExpiresAt = time.Now().Add(ttl)
+	s.records[key] = record
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for k, r := range s.records {
+		if !now.Before(r.ExpiresAt) {
+			delete(s.records, k)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	model "github.com/af-go/peach-common/pkg/model/database"
+)
+
+const defaultIdempotencyTable = "idempotency_keys"
+
+// NewMySQLIdempotencyStore open mysql/mariadb database and create table of idempotency records if not exist
+func NewMySQLIdempotencyStore(options model.MySQLOptions, table string) (*SQLIdempotencyStore, error) {
+	db, err := model.Open(options)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSQLIdempotencyStore(db, table)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := s.Migrate(context.Background()); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSQLIdempotencyStore create store on opened database, default table is idempotency_keys
+func NewSQLIdempotencyStore(db *sql.DB, table string) (*SQLIdempotencyStore, error) {
+	if table == "" {
+		table = defaultIdempotencyTable
+	}
+	if err := model.ValidateTableName(table); err != nil {
+		return nil, err
+	}
+	return &SQLIdempotencyStore{db: db, table: table}, nil
+}
+
+// SQLIdempotencyStore idempotency store in a sql table, the primary key on id serializes concurrent reservations
+type SQLIdempotencyStore struct {
+	db    *sql.DB
+	table string
+}
+
+// Migrate create table if not exist
+func (s *SQLIdempotencyStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id CHAR(64) NOT NULL PRIMARY KEY,
+	fingerprint CHAR(64) NOT NULL,
+	completed BOOLEAN NOT NULL DEFAULT FALSE,
+	status INT NOT NULL DEFAULT 0,
+	header TEXT,
+	body MEDIUMBLOB,
+	expires_at BIGINT NOT NULL,
+	INDEX idx_expires_at (expires_at)
+)`, s.table))
+	return err
+}
+
+// Reserve implements IdempotencyStore
+func (s *SQLIdempotencyStore) Reserve(ctx context.Context, key string, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	now := time.Now()
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = ? AND expires_at <= ?", s.table), key, now.UnixMilli()); err != nil {
+		return nil, err
+	}
+	_, insertErr := s.db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id, fingerprint, expires_at) VALUES (?, ?, ?)", s.table), key, fingerprint, now.Add(ttl).UnixMilli())
+	if insertErr == nil {
+		return nil, nil
+	}
+	// the key exists if the insert violates the primary key, otherwise report the insert error
+	existing, err := s.get(ctx, key)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, insertErr
+		}
+		return nil, err
+	}
+	return existing, nil
+}
+
+// Complete implements IdempotencyStore
+func (s *SQLIdempotencyStore) Complete(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET completed = TRUE, status = ?, header = ?, body = ?, expires_at = ? WHERE id = ?", s.table),
+		record.Status, string(header), record.Body, time.Now().Add(ttl).UnixMilli(), key)
+	return err
+}
+
+// Release implements IdempotencyStore
+func (s *SQLIdempotencyStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = ?", s.table), key)
+	return err
+}
+
+// Purge delete expired records, call it periodically to keep the table small
+func (s *SQLIdempotencyStore) Purge(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at <= ?", s.table), time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *SQLIdempotencyStore) get(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	var r IdempotencyRecord
+	var header sql.NullString
+	var expiresAt int64
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT fingerprint, completed, status, header, body, expires_at FROM %s WHERE id = ?", s.table), key)
+	if err := row.Scan(&r.Fingerprint, &r.Completed, &r.Status, &header, &r.Body, &expiresAt); err != nil {
+		return nil, err
+	}
+	if header.Valid && header.String != "" {
+		if err := json.Unmarshal([]byte(header.String), &r.Header); err != nil {
+			return nil, err
+		}
+	}
+	r.ExpiresAt = time.UnixMilli(expiresAt)
+	return &r, nil
+}
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/af-go/peach-common/pkg/log"
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var created int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	r := gin.New()
+	r.Use(func(gc *gin.Context) {
+		if user := gc.GetHeader("X-User"); user != "" {
+			gc.Set(principalKey, &Principal{Subject: user, Method: "jwt"})
+		}
+	})
+	r.Use(NewIdempotencyMiddleware(IdempotencyOptions{MaxBodyBytes: 64}, NewMemoryIdempotencyStore(), log.NewLogger(false)))
+	r.POST("/orders", func(gc *gin.Context) {
+		if gc.Query("wait") != "" {
+			close(started)
+			<-release
+		}
+		if gc.Query("fail") != "" {
+			gc.Status(http.StatusInternalServerError)
+			return
+		}
+		n := atomic.AddInt32(&created, 1)
+		gc.Header("Location", "/orders/1")
+		gc.SetCookie("session", gc.GetHeader("X-User"), 0, "/", "", true, true)
+		gc.JSON(http.StatusCreated, gin.H{"order": n})
+	})
+	do := func(path string, key string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("X-User", "alice")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := do("/orders", "k1", `{"item": "pear"}`)
+	retried := do("/orders", "k1", `{"item": "pear"}`)
+	if first.Code != http.StatusCreated || retried.Code != http.StatusCreated || retried.Body.String() != first.Body.String() {
+		t.Fatalf("expect replayed response, actual %d %s, %d %s", first.Code, first.Body.String(), retried.Code, retried.Body.String())
+	}
+	if retried.Header().Get("Idempotent-Replayed") != "true" || retried.Header().Get("Location") != "/orders/1" || created != 1 {
+		t.Fatalf("expect replayed headers and one order, actual %v, %d orders", retried.Header(), created)
+	}
+	if retried.Header().Get("Set-Cookie") != "" {
+		t.Fatalf("expect cookies of first response are not replayed, actual %v", retried.Header())
+	}
+	other := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"item": "pear"}`))
+	other.Header.Set("X-User", "bob")
+	other.Header.Set("Idempotency-Key", "k1")
+	w := httptest.NewRecorder()
+	if r.ServeHTTP(w, other); w.Header().Get("Idempotent-Replayed") != "" || created != 2 {
+		t.Fatalf("expect key is scoped by principal, actual %v, %d orders", w.Header(), created)
+	}
+	for i := 0; i < 2; i++ {
+		anonymous := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"item": "pear"}`))
+		anonymous.Header.Set("Idempotency-Key", "k1")
+		w = httptest.NewRecorder()
+		if r.ServeHTTP(w, anonymous); w.Header().Get("Idempotent-Replayed") != "" {
+			t.Fatalf("expect key of anonymous request is ignored, actual %v", w.Header())
+		}
+	}
+	if created != 4 {
+		t.Fatalf("expect anonymous requests are not deduplicated, actual %d orders", created)
+	}
+	if w := do("/orders", "k4", strings.Repeat("x", 65)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expect 413 for large body, actual %d", w.Code)
+	}
+	if w := do("/orders", "k1", `{"item": "apple"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expect 422 for reused key, actual %d", w.Code)
+	}
+	if do("/orders", "", `{}`); created != 5 {
+		t.Fatalf("expect request without key is not deduplicated")
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- do("/orders?wait=1", "k2", `{}`) }()
+	<-started
+	if w := do("/orders?wait=1", "k2", `{}`); w.Code != http.StatusConflict {
+		t.Fatalf("expect 409 for concurrent duplicate, actual %d", w.Code)
+	}
+	close(release)
+	if w := <-done; w.Code != http.StatusCreated {
+		t.Fatalf("expect first request to complete, actual %d", w.Code)
+	}
+
+	do("/orders?fail=1", "k3", `{}`)
+	if w := do("/orders?fail=1", "k3", `{}`); w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expect 5xx response is not replayed")
+	}
+}
@@ -0,0 +1,341 @@
+package http
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTOptions jwt bearer token options
+type JWTOptions struct {
+	// JWKSFile local json web key set file
+	JWKSFile string `json:"jwksFile" yaml:"jwksFile"`
+	// KeyFiles PEM encoded public keys or certificates
+	KeyFiles []string `json:"keyFiles" yaml:"keyFiles"`
+	// SecretEnvVar environment variable holds the HMAC secret
+	SecretEnvVar string   `json:"secretEnvVar" yaml:"secretEnvVar"`
+	Issuer       string   `json:"issuer" yaml:"issuer"`
+	Audiences    []string `json:"audiences" yaml:"audiences"`
+	// Leeway clock skew in seconds
+	Leeway int `json:"leeway" yaml:"leeway"`
+	// ScopeClaim claim holds scopes, space separated string or array, default "scope"
+	ScopeClaim string `json:"scopeClaim" yaml:"scopeClaim"`
+	// RolesClaim claim holds roles, default "roles"
+	RolesClaim string `json:"rolesClaim" yaml:"rolesClaim"`
+}
+
+// NewJWTAuthenticator create jwt authenticator, keys are loaded from JWKS file, key files and secret env var
+func NewJWTAuthenticator(options JWTOptions, logger *logr.Logger) (*JWTAuthenticator, error) {
+	a := JWTAuthenticator{options: options, keys: make(map[string]interface{})}
+	if a.options.ScopeClaim == "" {
+		a.options.ScopeClaim = "scope"
+	}
+	if a.options.RolesClaim == "" {
+		a.options.RolesClaim = "roles"
+	}
+	if options.JWKSFile != "" {
+		content, err := os.ReadFile(filepath.Clean(options.JWKSFile))
+		if err != nil {
+			logger.Error(err, "failed to open jwks file", "filename", options.JWKSFile)
+			return nil, err
+		}
+		keys, err := ParseJWKS(content)
+		if err != nil {
+			logger.Error(err, "failed to parse jwks file", "filename", options.JWKSFile)
+			return nil, err
+		}
+		for kid, k := range keys {
+			a.keys[kid] = k
+		}
+	}
+	for _, f := range options.KeyFiles {
+		content, err := os.ReadFile(filepath.Clean(f))
+		if err != nil {
+			logger.Error(err, "failed to open key file", "filename", f)
+			return nil, err
+		}
+		k, err := parsePEMPublicKey(content)
+		if err != nil {
+			logger.Error(err, "failed to parse key file", "filename", f)
+			return nil, err
+		}
+		a.keys[filepath.Base(f)] = k
+	}
+	if options.SecretEnvVar != "" {
+		secret := os.Getenv(options.SecretEnvVar)
+		if secret == "" {
+			return nil, fmt.Errorf("jwt secret env var %s is empty", options.SecretEnvVar)
+		}
+		a.keys[options.SecretEnvVar] = []byte(secret)
+	}
+	if len(a.keys) == 0 {
+		return nil, fmt.Errorf("no jwt verification key is configured")
+	}
+	parserOptions := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Duration(options.Leeway) * time.Second),
+		jwt.WithValidMethods(a.validMethods()),
+	}
+	if options.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(options.Issuer))
+	}
+	a.parser = jwt.NewParser(parserOptions...)
+	return &a, nil
+}
+
+// JWTAuthenticator authenticate request by jwt bearer token
+type JWTAuthenticator struct {
+	options JWTOptions
+	keys    map[string]interface{}
+	parser  *jwt.Parser
+}
+
+// Authenticate implements Authenticator
+func (a *JWTAuthenticator) Authenticate(req *http.Request) (*Principal, error) {
+	raw := bearerToken(req)
+	if raw == "" {
+		return nil, nil
+	}
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(raw, claims, a.keyFunc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if len(a.options.Audiences) > 0 {
+		aud, err := claims.GetAudience()
+		if err != nil || !intersects(aud, a.options.Audiences) {
+			return nil, fmt.Errorf("%w: audience is not accepted", ErrInvalidCredentials)
+		}
+	}
+	subject, _ := claims.GetSubject()
+	return &Principal{
+		Subject: subject,
+		Method:  "jwt",
+		Scopes:  claimStrings(claims[a.options.ScopeClaim]),
+		Roles:   claimStrings(claims[a.options.RolesClaim]),
+		Claims:  claims,
+	}, nil
+}
+
+func (a *JWTAuthenticator) keyFunc(token *jwt.Token) (interface{}, error) {
+	var key interface{}
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		k, ok := a.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %s", kid)
+		}
+		key = k
+	} else if len(a.keys) == 1 {
+		for _, k := range a.keys {
+			key = k
+		}
+	} else {
+		return nil, fmt.Errorf("token has no key id")
+	}
+	// make sure the algorithm matches the key type, e.g. a public key never verifies HMAC tokens
+	switch key.(type) {
+	case []byte:
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+	case *rsa.PublicKey:
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		default:
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+	case ed25519.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+	}
+	return key, nil
+}
+
+func (a *JWTAuthenticator) validMethods() []string {
+	methods := []string{}
+	seen := make(map[string]bool)
+	for _, k := range a.keys {
+		var algs []string
+		switch k.(type) {
+		case []byte:
+			algs = []string{"HS256", "HS384", "HS512"}
+		case *rsa.PublicKey:
+			algs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+		case *ecdsa.PublicKey:
+			algs = []string{"ES256", "ES384", "ES512"}
+		case ed25519.PublicKey:
+			algs = []string{"EdDSA"}
+		}
+		for _, alg := range algs {
+			if !seen[alg] {
+				seen[alg] = true
+				methods = append(methods, alg)
+			}
+		}
+	}
+	return methods
+}
+
+// JSONWebKey json web key, only the public parameters are used
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS parse json web key set, return verification keys by key id
+func ParseJWKS(content []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(content, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{})
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %d (%s): %w", i, k.Kid, err)
+		}
+		kid := k.Kid
+		if kid == "" {
+			kid = fmt.Sprintf("%d", i)
+		}
+		keys[kid] = key
+	}
+	return keys, nil
+}
+
+// PublicKey convert json web key to crypto key
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 key size %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func parsePEMPublicKey(content []byte) (interface{}, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block is found")
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
+
+func claimStrings(v interface{}) []string {
+	switch value := v.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		result := []string{}
+		for _, i := range value {
+			if s, ok := i.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func intersects(a []string, b []string) bool {
+	for _, v := range a {
+		if contains(b, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package http
+
+import (
+	"expvar"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMetricsPath = "/metrics"
+)
+
+// httpMetrics counters of rejected requests, published with expvar
+var httpMetrics = expvar.NewMap("peach_http_rejections")
+
+// MetricsHandler expose expvar variables as json
+type MetricsHandler struct {
+	path string
+}
+
+// NewMetricsHandler create metrics handler, path defaults to /metrics
+func NewMetricsHandler(path string) *MetricsHandler {
+	if path == "" {
+		path = defaultMetricsPath
+	}
+	return &MetricsHandler{path: path}
+}
+
+// Build build metrics handler
+func (h *MetricsHandler) Build(engine *gin.Engine) {
+	engine.GET(h.path, gin.WrapH(expvar.Handler()))
+}
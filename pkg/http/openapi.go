@@ -0,0 +1,613 @@
+package http
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	openAPIVersion       = "3.0.3"
+	defaultOpenAPIPath   = "/openapi.json"
+	defaultSwaggerUIPath = "/swagger"
+
+	defaultOpenAPIMaxBodyBytes = 1 << 20
+	defaultSuccessStatus       = http.StatusOK
+	componentsSchemasPath      = "#/components/schemas/"
+)
+
+//go:embed static/swagger.html static/swagger-ui
+var swaggerFS embed.FS
+
+// Route documentation of a route, Request and Response are sample values of go types, e.g. CreateItemRequest{}
+type Route struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Tags        []string
+	// Request fields tagged with uri, form or header become path, query or header parameters, the rest is the json body
+	Request  interface{}
+	Response interface{}
+	// SuccessStatus status of Response, default 200
+	SuccessStatus int
+	// Errors additional error statuses, rendered as problem details
+	Errors []int
+}
+
+// Describer handler which documents the routes it builds
+type Describer interface {
+	Routes() []Route
+}
+
+// OpenAPIOptions openapi document options
+type OpenAPIOptions struct {
+	Title       string `json:"title" yaml:"title"`
+	Version     string `json:"version" yaml:"version"`
+	Description string `json:"description" yaml:"description"`
+	// Path document path, default /openapi.json
+	Path string `json:"path" yaml:"path"`
+	// UIPath swagger ui path, default /swagger, "-" disables swagger ui
+	UIPath string `json:"uiPath" yaml:"uiPath"`
+	// ValidateRequests validate requests of documented routes against the generated schema
+	ValidateRequests bool `json:"validateRequests" yaml:"validateRequests"`
+	// MaxBodyBytes max size of request bodies read by validation, default 1MB
+	MaxBodyBytes int64 `json:"maxBodyBytes" yaml:"maxBodyBytes"`
+}
+
+// OpenAPIDocument openapi 3 document
+type OpenAPIDocument struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       OpenAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components OpenAPIComponents                `json:"components"`
+}
+
+// OpenAPIInfo document info
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIComponents reusable schemas
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// Operation openapi operation
+type Operation struct {
+	OperationID string               `json:"operationId,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter openapi parameter
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody openapi request body
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response openapi response
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType openapi media type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema json schema subset used by openapi 3.0
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Example              interface{}        `json:"example,omitempty"`
+}
+
+// NewOpenAPIHandler create handler serving the document of routes described by handlers and registered on the engine
+func NewOpenAPIHandler(options OpenAPIOptions, handlers ...Handler) *OpenAPIHandler {
+	if options.Path == "" {
+		options.Path = defaultOpenAPIPath
+	}
+	if options.UIPath == "" {
+		options.UIPath = defaultSwaggerUIPath
+	}
+	if options.Title == "" {
+		options.Title = "API"
+	}
+	if options.MaxBodyBytes <= 0 {
+		options.MaxBodyBytes = defaultOpenAPIMaxBodyBytes
+	}
+	if options.Version == "" {
+		options.Version = "1.0.0"
+	}
+	h := OpenAPIHandler{options: options, routes: []Route{}}
+	for _, handler := range handlers {
+		if d, ok := handler.(Describer); ok {
+			h.routes = append(h.routes, d.Routes()...)
+		}
+	}
+	return &h
+}
+
+// OpenAPIHandler serve openapi document and swagger ui, optionally validate requests
+type OpenAPIHandler struct {
+	options  OpenAPIOptions
+	routes   []Route
+	engine   *gin.Engine
+	once     sync.Once
+	document *OpenAPIDocument
+	content  []byte
+}
+
+// Describe add route documentation, must be called before the document is served
+func (h *OpenAPIHandler) Describe(routes ...Route) *OpenAPIHandler {
+	h.routes = append(h.routes, routes...)
+	return h
+}
+
+// Build build openapi handler
+func (h *OpenAPIHandler) Build(engine *gin.Engine) {
+	h.engine = engine
+	engine.GET(h.options.Path, h.serveDocument)
+	if h.options.UIPath != "-" {
+		engine.GET(h.options.UIPath, h.serveUI)
+		engine.GET(h.assetsPath()+"/:file", h.serveAsset)
+	}
+}
+
+// assetsPath path of swagger ui assets embedded from swagger-ui-dist
+func (h *OpenAPIHandler) assetsPath() string {
+	return strings.TrimSuffix(h.options.UIPath, "/") + "/assets"
+}
+
+func (h *OpenAPIHandler) serveAsset(gc *gin.Context) {
+	gc.FileFromFS("static/swagger-ui/"+gc.Param("file"), http.FS(swaggerFS))
+}
+
+// Document generate document, routes registered on the engine but not described are included with minimal operations
+func (h *OpenAPIHandler) Document() *OpenAPIDocument {
+	h.once.Do(func() {
+		h.document = h.generate()
+		h.content, _ = json.Marshal(h.document)
+	})
+	return h.document
+}
+
+func (h *OpenAPIHandler) serveDocument(gc *gin.Context) {
+	h.Document()
+	gc.Data(http.StatusOK, "application/json", h.content)
+}
+
+func (h *OpenAPIHandler) serveUI(gc *gin.Context) {
+	content, err := swaggerFS.ReadFile("static/swagger.html")
+	if err != nil {
+		RenderError(gc, err)
+		return
+	}
+	t, err := template.New("swagger").Parse(string(content))
+	if err != nil {
+		RenderError(gc, err)
+		return
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, map[string]string{"Title": h.options.Title, "SpecURL": h.options.Path, "AssetsPath": h.assetsPath()}); err != nil {
+		RenderError(gc, err)
+		return
+	}
+	gc.Data(http.StatusOK, "text/html; charset=utf-8", b.Bytes())
+}
+
+func (h *OpenAPIHandler) generate() *OpenAPIDocument {
+	doc := OpenAPIDocument{
+		OpenAPI:    openAPIVersion,
+		Info:       OpenAPIInfo{Title: h.options.Title, Version: h.options.Version, Description: h.options.Description},
+		Paths:      make(map[string]map[string]*Operation),
+		Components: OpenAPIComponents{Schemas: make(map[string]*Schema)},
+	}
+	g := schemaGenerator{schemas: doc.Components.Schemas, names: make(map[reflect.Type]string)}
+	documented := make(map[string]bool)
+	for _, r := range h.routes {
+		path := openAPIPath(r.Path)
+		method := strings.ToLower(r.Method)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Operation)
+		}
+		doc.Paths[path][method] = g.operation(r)
+		documented[r.Method+" "+r.Path] = true
+	}
+	if h.engine != nil {
+		for _, info := range h.engine.Routes() {
+			if documented[info.Method+" "+info.Path] || info.Path == h.options.Path || info.Path == h.options.UIPath || info.Path == h.assetsPath()+"/:file" {
+				continue
+			}
+			path := openAPIPath(info.Path)
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = make(map[string]*Operation)
+			}
+			doc.Paths[path][strings.ToLower(info.Method)] = g.operation(Route{Method: info.Method, Path: info.Path})
+		}
+	}
+	return &doc
+}
+
+// operation lookup documented operation by gin method and full path
+func (h *OpenAPIHandler) operation(method string, fullPath string) *Operation {
+	doc := h.Document()
+	item, ok := doc.Paths[openAPIPath(fullPath)]
+	if !ok {
+		return nil
+	}
+	return item[strings.ToLower(method)]
+}
+
+// openAPIPath convert gin path /items/:id/*file to /items/{id}/{file}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func pathParameters(path string) []string {
+	names := []string{}
+	for _, s := range strings.Split(path, "/") {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			names = append(names, s[1:])
+		}
+	}
+	return names
+}
+
+type schemaGenerator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func (g *schemaGenerator) operation(r Route) *Operation {
+	op := Operation{
+		OperationID: operationID(r.Method, r.Path),
+		Summary:     r.Summary,
+		Description: r.Description,
+		Tags:        r.Tags,
+		Responses:   make(map[string]*Response),
+	}
+	declared := make(map[string]bool)
+	if r.Request != nil {
+		t := indirectType(reflect.TypeOf(r.Request))
+		body := Schema{Type: "object", Properties: make(map[string]*Schema)}
+		if t.Kind() == reflect.Struct {
+			for _, f := range structFields(t) {
+				if name := tagName(f, "uri"); name != "" {
+					op.Parameters = append(op.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: g.schema(f.Type, f.Tag)})
+					declared[name] = true
+				} else if name := tagName(f, "form"); name != "" {
+					op.Parameters = append(op.Parameters, Parameter{Name: name, In: "query", Required: hasRule(f.Tag, "required"), Schema: g.schema(f.Type, f.Tag)})
+				} else if name := tagName(f, "header"); name != "" {
+					op.Parameters = append(op.Parameters, Parameter{Name: name, In: "header", Required: hasRule(f.Tag, "required"), Schema: g.schema(f.Type, f.Tag)})
+				} else if name := jsonName(f); name != "" {
+					body.Properties[name] = g.schema(f.Type, f.Tag)
+					if hasRule(f.Tag, "required") {
+						body.Required = append(body.Required, name)
+					}
+				}
+			}
+			if len(body.Properties) > 0 {
+				schema := &body
+				if len(op.Parameters) == 0 && t.Name() != "" {
+					schema = g.schema(t, "")
+				}
+				op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{"application/json": {Schema: schema}}}
+			}
+		} else {
+			op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{"application/json": {Schema: g.schema(t, "")}}}
+		}
+	}
+	for _, name := range pathParameters(r.Path) {
+		if !declared[name] {
+			op.Parameters = append(op.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	status := r.SuccessStatus
+	if status == 0 {
+		status = defaultSuccessStatus
+	}
+	success := Response{Description: http.StatusText(status)}
+	if r.Response != nil && status != http.StatusNoContent {
+		success.Content = map[string]MediaType{"application/json": {Schema: g.schema(reflect.TypeOf(r.Response), "")}}
+	}
+	op.Responses[strconv.Itoa(status)] = &success
+	if len(r.Errors) > 0 {
+		problem := g.schema(reflect.TypeOf(Problem{}), "")
+		for _, s := range r.Errors {
+			op.Responses[strconv.Itoa(s)] = &Response{Description: http.StatusText(s), Content: map[string]MediaType{ProblemContentType: {Schema: problem}}}
+		}
+	}
+	return &op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema generate schema of go type, named structs are registered as components
+func (g *schemaGenerator) schema(t reflect.Type, tag reflect.StructTag) *Schema {
+	nullable := false
+	if t.Kind() == reflect.Ptr {
+		nullable = true
+		t = t.Elem()
+	}
+	var s *Schema
+	switch {
+	case t == timeType:
+		s = &Schema{Type: "string", Format: "date-time"}
+	case t == reflect.TypeOf(Problem{}):
+		s = g.component(t, func() *Schema {
+			return &Schema{Type: "object", Properties: map[string]*Schema{
+				"type":     {Type: "string"},
+				"title":    {Type: "string"},
+				"status":   {Type: "integer"},
+				"detail":   {Type: "string"},
+				"instance": {Type: "string"},
+			}}
+		})
+	case t.Kind() == reflect.Struct:
+		if t.Name() != "" {
+			s = g.component(t, func() *Schema { return g.object(t) })
+		} else {
+			s = g.object(t)
+		}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			s = &Schema{Type: "string", Format: "byte"}
+		} else {
+			s = &Schema{Type: "array", Items: g.schema(t.Elem(), "")}
+		}
+	case t.Kind() == reflect.Map:
+		s = &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem(), "")}
+	case t.Kind() == reflect.String:
+		s = &Schema{Type: "string"}
+	case t.Kind() == reflect.Bool:
+		s = &Schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		s = &Schema{Type: "integer"}
+		if t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64 {
+			s.Format = "int64"
+		} else if t.Kind() == reflect.Int32 || t.Kind() == reflect.Uint32 {
+			s.Format = "int32"
+		}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s = &Schema{Type: "number"}
+	default:
+		s = &Schema{}
+	}
+	if tag != "" && s.Ref == "" {
+		applyRules(s, tag)
+	}
+	if nullable && s.Ref == "" {
+		s.Nullable = true
+	}
+	return s
+}
+
+func (g *schemaGenerator) component(t reflect.Type, build func() *Schema) *Schema {
+	name, ok := g.names[t]
+	if !ok {
+		name = g.componentName(t)
+		g.names[t] = name
+		// reserve the name first, recursive types refer to themselves
+		g.schemas[name] = &Schema{}
+		*g.schemas[name] = *build()
+	}
+	return &Schema{Ref: componentsSchemasPath + name}
+}
+
+var typeQualifier = regexp.MustCompile(`(?:[\w.\-]+/)*\w+\.`)
+var invalidComponentChars = regexp.MustCompile(`[^A-Za-z0-9._\-]+`)
+
+// componentName name of type in components, type arguments lose their packages, e.g. Page[example.com/x.Item] is Page_Item.
+// A type named like another type of a different package is qualified by its package name, then numbered
+func (g *schemaGenerator) componentName(t reflect.Type) string {
+	base := strings.Trim(invalidComponentChars.ReplaceAllString(typeQualifier.ReplaceAllString(t.Name(), ""), "_"), "_")
+	name := base
+	if _, taken := g.schemas[name]; taken {
+		name = invalidComponentChars.ReplaceAllString(path.Base(t.PkgPath()), "_") + "." + base
+	}
+	for i := 2; ; i++ {
+		if _, taken := g.schemas[name]; !taken {
+			return name
+		}
+		name = fmt.Sprintf("%s.%s%d", invalidComponentChars.ReplaceAllString(path.Base(t.PkgPath()), "_"), base, i)
+	}
+}
+
+func (g *schemaGenerator) object(t reflect.Type) *Schema {
+	s := Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, f := range structFields(t) {
+		name := jsonName(f)
+		if name == "" {
+			continue
+		}
+		s.Properties[name] = g.schema(f.Type, f.Tag)
+		if hasRule(f.Tag, "required") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return &s
+}
+
+// applyRules translate binding rules and example tag into schema constraints
+func applyRules(s *Schema, tag reflect.StructTag) {
+	for _, rule := range strings.Split(tag.Get("binding"), ",") {
+		kv := strings.SplitN(rule, "=", 2)
+		if len(kv) != 2 {
+			if kv[0] == "email" {
+				s.Format = "email"
+			}
+			continue
+		}
+		switch kv[0] {
+		case "min", "gte", "max", "lte":
+			v, err := strconv.ParseFloat(kv[1], 64)
+			if err != nil {
+				continue
+			}
+			lower := kv[0] == "min" || kv[0] == "gte"
+			n := int(v)
+			if s.Type == "string" {
+				if lower {
+					s.MinLength = &n
+				} else {
+					s.MaxLength = &n
+				}
+			} else if s.Type == "array" {
+				if lower {
+					s.MinItems = &n
+				} else {
+					s.MaxItems = &n
+				}
+			} else if lower {
+				s.Minimum = &v
+			} else {
+				s.Maximum = &v
+			}
+		case "oneof":
+			for _, o := range strings.Fields(kv[1]) {
+				s.Enum = append(s.Enum, enumValue(s.Type, o))
+			}
+		}
+	}
+	if example := tag.Get("example"); example != "" {
+		s.Example = enumValue(s.Type, example)
+	}
+	if description := tag.Get("description"); description != "" {
+		s.Description = description
+	}
+}
+
+func enumValue(schemaType string, v string) interface{} {
+	switch schemaType {
+	case "integer":
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
+
+// structFields exported fields, embedded structs are flattened like encoding/json does
+func structFields(t reflect.Type) []reflect.StructField {
+	fields := []reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && indirectType(f.Type).Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			fields = append(fields, structFields(indirectType(f.Type))...)
+			continue
+		}
+		if f.IsExported() {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func tagName(f reflect.StructField, tag string) string {
+	name := strings.SplitN(f.Tag.Get(tag), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+func jsonName(f reflect.StructField) string {
+	tag, ok := f.Tag.Lookup("json")
+	if !ok {
+		return f.Name
+	}
+	name := strings.SplitN(tag, ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func hasRule(tag reflect.StructTag, rule string) bool {
+	for _, r := range strings.Split(tag.Get("binding"), ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func operationID(method string, path string) string {
+	parts := []string{strings.ToLower(method)}
+	for _, s := range strings.Split(path, "/") {
+		s = strings.TrimLeft(s, ":*")
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "_")
+}
@@ -0,0 +1,140 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type itemRequest struct {
+	ID      string   `uri:"id" json:"-" binding:"required"`
+	Verbose bool     `form:"verbose"`
+	Name    string   `json:"name" binding:"required,max=8"`
+	Kind    string   `json:"kind" binding:"oneof=a b"`
+	Tags    []string `json:"tags"`
+}
+
+type itemResponse struct {
+	ID   string `json:"id" example:"42"`
+	Name string `json:"name"`
+}
+
+type itemHandler struct{}
+
+func (h *itemHandler) Build(engine *gin.Engine) {
+	engine.PUT("/items/:id", func(gc *gin.Context) {
+		gc.JSON(200, itemResponse{ID: gc.Param("id")})
+	})
+	engine.GET("/undocumented", func(gc *gin.Context) {})
+}
+
+func (h *itemHandler) Routes() []Route {
+	return []Route{{Method: http.MethodPut, Path: "/items/:id", Summary: "update item", Request: itemRequest{}, Response: itemResponse{}, Errors: []int{404}}}
+}
+
+func TestOpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler := &itemHandler{}
+	openapi := NewOpenAPIHandler(OpenAPIOptions{Title: "items", MaxBodyBytes: 256}, handler, NewSimpleHealthyHandler())
+	r.Use(openapi.RequestValidator())
+	handler.Build(r)
+	NewSimpleHealthyHandler().Build(r)
+	openapi.Build(r)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	var doc OpenAPIDocument
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("failed to unmarshal document %v", err)
+	}
+	op := doc.Paths["/items/{id}"]["put"]
+	if op == nil || len(op.Parameters) != 2 || op.RequestBody == nil {
+		t.Fatalf("unexpected operation %+v", op)
+	}
+	if op.Responses["200"].Content["application/json"].Schema.Ref != "#/components/schemas/itemResponse" {
+		t.Fatalf("unexpected response %+v", op.Responses["200"])
+	}
+	if _, ok := op.Responses["404"].Content[ProblemContentType]; !ok {
+		t.Fatalf("expect problem response for 404")
+	}
+	if doc.Paths["/healthz"]["get"] == nil || doc.Paths["/undocumented"]["get"] == nil {
+		t.Fatalf("expect every registered route in document")
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "/openapi.json") {
+		t.Fatalf("unexpected swagger ui %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "https://") {
+		t.Fatalf("expect swagger ui assets served locally, actual %s", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger/assets/swagger-ui-bundle.js", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "SwaggerUIBundle") {
+		t.Fatalf("expect embedded swagger ui bundle, actual %d", w.Code)
+	}
+
+	cases := []struct {
+		path   string
+		body   string
+		status int
+		fields int
+	}{
+		{path: "/items/1", body: `{"name": "pear", "kind": "a"}`, status: 200},
+		{path: "/items/1?verbose=maybe", body: `{"kind": "c", "name": "watermelon", "tags": [1]}`, status: 400, fields: 4},
+		{path: "/items/1", body: `[]`, status: 400, fields: 1},
+		{path: "/items/1", body: `{"name": "` + strings.Repeat("a", 300) + `"}`, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, c := range cases {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, c.path, strings.NewReader(c.body)))
+		if w.Code != c.status {
+			t.Fatalf("%s %s: expect %d, actual %d %s", c.path, c.body, c.status, w.Code, w.Body.String())
+		}
+		if c.fields > 0 {
+			var p Problem
+			_ = json.Unmarshal(w.Body.Bytes(), &p)
+			if errs, _ := p.Extensions["errors"].([]interface{}); len(errs) != c.fields {
+				t.Fatalf("%s %s: expect %d field errors, actual %v", c.path, c.body, c.fields, p.Extensions)
+			}
+		}
+	}
+}
+
+type itemPage[T any] struct {
+	Items []T `json:"items"`
+}
+
+type cookiesResponse struct {
+	Own      Cookie                 `json:"own"`
+	Standard http.Cookie            `json:"standard"`
+	Page     itemPage[itemResponse] `json:"page"`
+}
+
+func TestOpenAPIComponentNames(t *testing.T) {
+	g := schemaGenerator{schemas: make(map[string]*Schema), names: make(map[reflect.Type]string)}
+	g.schema(reflect.TypeOf(cookiesResponse{}), "")
+	g.schema(reflect.TypeOf(Cookie{}), "")
+	valid := regexp.MustCompile(`^[A-Za-z0-9._\-]+$`)
+	for name := range g.schemas {
+		if !valid.MatchString(name) {
+			t.Fatalf("expect valid component name, actual %s", name)
+		}
+	}
+	for _, name := range []string{"cookiesResponse", "Cookie", "http.Cookie", "itemPage_itemResponse", "itemResponse"} {
+		if _, ok := g.schemas[name]; !ok {
+			t.Fatalf("expect component %s, actual %v", name, g.schemas)
+		}
+	}
+	if len(g.schemas) != 5 {
+		t.Fatalf("expect one component per type, actual %v", g.schemas)
+	}
+}
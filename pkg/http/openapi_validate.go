@@ -0,0 +1,253 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestValidator create middleware which validates parameters and json body of documented routes against the document.
+// It must be installed before the routes are built, invalid requests are rejected with field level problem details.
+func (h *OpenAPIHandler) RequestValidator() gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		if gc.FullPath() == "" {
+			gc.Next()
+			return
+		}
+		op := h.operation(gc.Request.Method, gc.FullPath())
+		if op == nil {
+			gc.Next()
+			return
+		}
+		v := schemaValidator{schemas: h.Document().Components.Schemas}
+		for _, p := range op.Parameters {
+			var value string
+			var present bool
+			switch p.In {
+			case "path":
+				value = gc.Param(p.Name)
+				present = value != ""
+			case "query":
+				value, present = gc.GetQuery(p.Name)
+			case "header":
+				value = gc.GetHeader(p.Name)
+				present = value != ""
+			}
+			if !present {
+				if p.Required {
+					v.fail(p.Name, "required", "", "is required")
+				}
+				continue
+			}
+			v.validate(p.Name, parseParameter(value, v.resolve(p.Schema)), p.Schema)
+		}
+		if op.RequestBody != nil {
+			if media, ok := op.RequestBody.Content["application/json"]; ok {
+				if err := h.validateBody(gc, &v, media.Schema, op.RequestBody.Required); err != nil {
+					RenderProblem(gc, NewProblem(http.StatusRequestEntityTooLarge, err.Error()))
+					gc.Abort()
+					return
+				}
+			}
+		}
+		if len(v.errors) > 0 {
+			p := NewProblem(http.StatusBadRequest, "request validation failed").With("errors", v.errors)
+			RenderProblem(gc, p)
+			gc.Abort()
+			return
+		}
+		gc.Next()
+	}
+}
+
+// validateBody validate json body, an error is returned if the body is larger than MaxBodyBytes
+func (h *OpenAPIHandler) validateBody(gc *gin.Context, v *schemaValidator, schema *Schema, required bool) error {
+	if gc.Request.Body == nil {
+		if required {
+			v.fail("body", "required", "", "is required")
+		}
+		return nil
+	}
+	content, err := io.ReadAll(http.MaxBytesReader(gc.Writer, gc.Request.Body, h.options.MaxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fmt.Errorf("request body is larger than %d bytes", tooLarge.Limit)
+		}
+		v.fail("body", "read", "", err.Error())
+		return nil
+	}
+	// handlers bind the body again
+	gc.Request.Body = io.NopCloser(bytes.NewReader(content))
+	if len(bytes.TrimSpace(content)) == 0 {
+		if required {
+			v.fail("body", "required", "", "is required")
+		}
+		return nil
+	}
+	var body interface{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		v.fail("body", "json", "", err.Error())
+		return nil
+	}
+	v.validate("", body, schema)
+	return nil
+}
+
+// parseParameter convert parameter string to the json value its schema expects, invalid values stay strings
+func parseParameter(value string, s *Schema) interface{} {
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	case "array":
+		values := []interface{}{}
+		for _, item := range strings.Split(value, ",") {
+			values = append(values, parseParameter(item, s.Items))
+		}
+		return values
+	}
+	return value
+}
+
+type schemaValidator struct {
+	schemas map[string]*Schema
+	errors  []FieldError
+}
+
+func (v *schemaValidator) fail(field string, rule string, param string, message string) {
+	v.errors = append(v.errors, FieldError{Field: field, Rule: rule, Param: param, Message: message})
+}
+
+func (v *schemaValidator) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = v.schemas[strings.TrimPrefix(s.Ref, componentsSchemasPath)]
+	}
+	if s == nil {
+		return &Schema{}
+	}
+	return s
+}
+
+func (v *schemaValidator) validate(path string, value interface{}, schema *Schema) {
+	s := v.resolve(schema)
+	if value == nil {
+		if !s.Nullable && s.Type != "" {
+			v.fail(path, "type", s.Type, fmt.Sprintf("must be %s", s.Type))
+		}
+		return
+	}
+	switch s.Type {
+	case "object":
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			v.fail(path, "type", s.Type, "must be object")
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := m[name]; !ok {
+				v.fail(join(path, name), "required", "", "is required")
+			}
+		}
+		for name, item := range m {
+			if p, ok := s.Properties[name]; ok {
+				v.validate(join(path, name), item, p)
+			} else if s.AdditionalProperties != nil {
+				v.validate(join(path, name), item, s.AdditionalProperties)
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			v.fail(path, "type", s.Type, "must be array")
+			return
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			v.fail(path, "min", strconv.Itoa(*s.MinItems), fmt.Sprintf("must contain at least %d items", *s.MinItems))
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			v.fail(path, "max", strconv.Itoa(*s.MaxItems), fmt.Sprintf("must contain at most %d items", *s.MaxItems))
+		}
+		for i, item := range items {
+			v.validate(fmt.Sprintf("%s[%d]", path, i), item, s.Items)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			v.fail(path, "type", s.Type, "must be string")
+			return
+		}
+		n := len([]rune(str))
+		if s.MinLength != nil && n < *s.MinLength {
+			v.fail(path, "min", strconv.Itoa(*s.MinLength), fmt.Sprintf("must be at least %d characters", *s.MinLength))
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			v.fail(path, "max", strconv.Itoa(*s.MaxLength), fmt.Sprintf("must be at most %d characters", *s.MaxLength))
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				v.fail(path, "format", s.Format, "must be RFC 3339 date-time")
+			}
+		}
+		v.validateEnum(path, str, s)
+	case "integer", "number":
+		num, ok := value.(json.Number)
+		if !ok {
+			v.fail(path, "type", s.Type, fmt.Sprintf("must be %s", s.Type))
+			return
+		}
+		f, err := num.Float64()
+		if err != nil || (s.Type == "integer" && f != math.Trunc(f)) {
+			v.fail(path, "type", s.Type, fmt.Sprintf("must be %s", s.Type))
+			return
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			v.fail(path, "min", strconv.FormatFloat(*s.Minimum, 'f', -1, 64), fmt.Sprintf("must be at least %v", *s.Minimum))
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			v.fail(path, "max", strconv.FormatFloat(*s.Maximum, 'f', -1, 64), fmt.Sprintf("must be at most %v", *s.Maximum))
+		}
+		v.validateEnum(path, f, s)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.fail(path, "type", s.Type, "must be boolean")
+		}
+	}
+}
+
+func (v *schemaValidator) validateEnum(path string, value interface{}, s *Schema) {
+	if len(s.Enum) == 0 {
+		return
+	}
+	options := []string{}
+	for _, e := range s.Enum {
+		if fmt.Sprintf("%v", e) == fmt.Sprintf("%v", value) {
+			return
+		}
+		options = append(options, fmt.Sprintf("%v", e))
+	}
+	v.fail(path, "oneof", strings.Join(options, " "), fmt.Sprintf("must be one of [%s]", strings.Join(options, " ")))
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
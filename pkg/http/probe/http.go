@@ -0,0 +1,66 @@
+package probe
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// HTTPProbeOptions http probe options
+type HTTPProbeOptions struct {
+	URL    string `json:"url" yaml:"url"`
+	Method string `json:"method" yaml:"method"`
+	// ExpectedStatus statuses of a healthy endpoint, default any 2xx or 3xx
+	ExpectedStatus []int `json:"expectedStatus" yaml:"expectedStatus"`
+	// Timeout seconds of the probe request, default 5
+	Timeout int `json:"timeout" yaml:"timeout"`
+}
+
+func BuildHTTPProbe(options HTTPProbeOptions, logger *logr.Logger) *HTTPProbe {
+	if options.Method == "" {
+		options.Method = http.MethodGet
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 5
+	}
+	c := HTTPProbe{options: options, logger: logger, client: &http.Client{
+		Timeout: time.Duration(options.Timeout) * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+	return &c
+}
+
+type HTTPProbe struct {
+	client  *http.Client
+	options HTTPProbeOptions
+	logger  *logr.Logger
+}
+
+func (c *HTTPProbe) Do() bool {
+	req, err := http.NewRequestWithContext(context.Background(), c.options.Method, c.options.URL, nil)
+	if err != nil {
+		c.logger.Error(err, "failed to create probe request", "url", c.options.URL)
+		return false
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.logger.V(1).Info("http probe failed", "url", c.options.URL, "err", err.Error())
+		return false
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if len(c.options.ExpectedStatus) == 0 {
+		return resp.StatusCode >= 200 && resp.StatusCode < 400
+	}
+	for _, status := range c.options.ExpectedStatus {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
@@ -2,12 +2,9 @@ package probe
 
 import (
 	"database/sql"
-	"fmt"
-	"time"
 
 	model "github.com/af-go/peach-common/pkg/model/database"
 	"github.com/go-logr/logr"
-	_ "github.com/go-sql-driver/mysql"
 )
 
 func BuildMySQLProbe(options model.MySQLOptions, logger *logr.Logger) *MySQLProbe {
@@ -28,15 +25,11 @@ type MySQLProbe struct {
 
 func (c *MySQLProbe) init() error {
 	var err error
-	dsn := fmt.Sprintf("%s:%s@(%s:%d)/%s", c.options.Username, c.options.Password, c.options.Host, c.options.Port, c.options.Database)
-	c.db, err = sql.Open("mysql", dsn)
+	c.db, err = model.Open(c.options)
 	if err != nil {
-		c.logger.Error(err, "failed to open mysql/mariadb connection", "dsn", dsn)
+		c.logger.Error(err, "failed to open mysql/mariadb connection", "host", c.options.Host, "port", c.options.Port, "database", c.options.Database)
 		return err
 	}
-	c.db.SetConnMaxLifetime(time.Minute * 3)
-	c.db.SetMaxOpenConns(10)
-	c.db.SetMaxIdleConns(10)
 	return nil
 }
 
@@ -0,0 +1,318 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+
+	defaultProblemType = "about:blank"
+)
+
+var useJSONFieldNamesOnce sync.Once
+
+// UseJSONFieldNames report json field names instead of go struct field names in validation errors,
+// it changes the global validator of gin so it must be called once at startup before requests are served
+func UseJSONFieldNames() {
+	useJSONFieldNamesOnce.Do(func() {
+		if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+			v.RegisterTagNameFunc(jsonFieldName)
+		}
+	})
+}
+
+// Problem RFC 7807 problem details, it implements error so handlers can return it directly
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Extensions additional members, serialized at top level
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// NewProblem create problem with status, title defaults to status text
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{Type: defaultProblemType, Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// With add extension member
+func (p *Problem) With(key string, value interface{}) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]interface{})
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+// Error implements error
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return fmt.Sprintf("[%d] %s: %s", p.Status, p.Title, p.Detail)
+	}
+	return fmt.Sprintf("[%d] %s", p.Status, p.Title)
+}
+
+// MarshalJSON merge extensions into problem members
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type plain Problem
+	content, err := json.Marshal(plain(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return content, err
+	}
+	m := make(map[string]interface{})
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON collect unknown members into extensions
+func (p *Problem) UnmarshalJSON(content []byte) error {
+	type plain Problem
+	var v plain
+	if err := json.Unmarshal(content, &v); err != nil {
+		return err
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(content, &m); err != nil {
+		return err
+	}
+	for _, k := range []string{"type", "title", "status", "detail", "instance"} {
+		delete(m, k)
+	}
+	*p = Problem(v)
+	if len(m) > 0 {
+		p.Extensions = m
+	}
+	return nil
+}
+
+// FieldError field level validation error
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// ErrorMapping map an error to problem type, title and status
+type ErrorMapping struct {
+	Status int
+	Type   string
+	Title  string
+	match  func(err error) bool
+	// detail of 5xx problems, the message of sentinel errors, wrapped errors may carry internals
+	detail string
+}
+
+// ErrorRegistry map go error types and sentinel errors to problems, the first registered match wins
+type ErrorRegistry struct {
+	mu       sync.RWMutex
+	mappings []ErrorMapping
+}
+
+// NewErrorRegistry create empty error registry
+func NewErrorRegistry() *ErrorRegistry {
+	return &ErrorRegistry{}
+}
+
+// DefaultErrorRegistry registry used by RenderError
+var DefaultErrorRegistry = newDefaultErrorRegistry()
+
+func newDefaultErrorRegistry() *ErrorRegistry {
+	r := NewErrorRegistry()
+	r.Register(ErrUnauthenticated, http.StatusUnauthorized, "", "")
+	r.Register(ErrInvalidCredentials, http.StatusUnauthorized, "", "")
+	r.Register(ErrForbidden, http.StatusForbidden, "", "")
+	r.Register(ErrRateLimited, http.StatusTooManyRequests, "", "")
+	r.Register(ErrOverloaded, http.StatusServiceUnavailable, "", "")
+	r.Register(ErrIdempotencyKeyInvalid, http.StatusBadRequest, "", "")
+	r.Register(ErrIdempotencyKeyRequired, http.StatusBadRequest, "", "")
+	r.Register(ErrIdempotencyInFlight, http.StatusConflict, "", "")
+	r.Register(ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, "", "")
+	r.Register(ErrBadGateway, http.StatusBadGateway, "", "")
+	r.Register(ErrGatewayTimeout, http.StatusGatewayTimeout, "", "")
+	r.Register(ErrNoHealthyUpstream, http.StatusServiceUnavailable, "", "")
+	r.Register(ErrCSRFTokenInvalid, http.StatusForbidden, "", "")
+	return r
+}
+
+// Register map sentinel error, matched by errors.Is
+func (r *ErrorRegistry) Register(target error, status int, problemType string, title string) {
+	r.add(ErrorMapping{Status: status, Type: problemType, Title: title, detail: target.Error(), match: func(err error) bool {
+		return errors.Is(err, target)
+	}})
+}
+
+// RegisterErrorType map error type T, matched by errors.As
+func RegisterErrorType[T error](r *ErrorRegistry, status int, problemType string, title string) {
+	r.add(ErrorMapping{Status: status, Type: problemType, Title: title, match: func(err error) bool {
+		var target T
+		return errors.As(err, &target)
+	}})
+}
+
+func (r *ErrorRegistry) add(m ErrorMapping) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mappings = append(r.mappings, m)
+}
+
+// Problem convert error to problem, unknown errors become 500 and mapped 5xx errors carry no details of the error itself.
+// json syntax and type errors are not mapped, Bind reports errors of decoding requests as 400 problems
+func (r *ErrorRegistry) Problem(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	var he HTTPError
+	if errors.As(err, &he) {
+		return NewProblem(he.Code, he.Message)
+	}
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		return ValidationProblem(ve)
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, m := range r.mappings {
+		if !m.match(err) {
+			continue
+		}
+		detail := err.Error()
+		if m.Status >= http.StatusInternalServerError {
+			detail = m.detail
+		}
+		p := NewProblem(m.Status, detail)
+		if m.Type != "" {
+			p.Type = m.Type
+		}
+		if m.Title != "" {
+			p.Title = m.Title
+		}
+		return p
+	}
+	return NewProblem(http.StatusInternalServerError, "")
+}
+
+// ValidationProblem render validation errors as field level problem details
+func ValidationProblem(errs validator.ValidationErrors) *Problem {
+	fields := []FieldError{}
+	for _, fe := range errs {
+		fields = append(fields, FieldError{
+			Field:   fieldPath(fe.Namespace()),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: validationMessage(fe),
+		})
+	}
+	p := NewProblem(http.StatusBadRequest, "request validation failed")
+	return p.With("errors", fields)
+}
+
+// RenderProblem write problem as application/problem+json
+func RenderProblem(gc *gin.Context, p *Problem) {
+	problem := *p
+	if problem.Instance == "" {
+		problem.Instance = gc.Request.URL.Path
+	}
+	gc.Render(problem.Status, problemRender{problem: &problem})
+}
+
+// RenderError map error with DefaultErrorRegistry and render it as problem
+func RenderError(gc *gin.Context, err error) {
+	p := DefaultErrorRegistry.Problem(err)
+	if p.Status >= http.StatusInternalServerError && (gc.Errors.Last() == nil || gc.Errors.Last().Err != err) {
+		// details are hidden from the client, the access log reports the error
+		_ = gc.Error(err)
+	}
+	RenderProblem(gc, p)
+}
+
+// HandlerFunc gin handler which returns error, see Wrap
+type HandlerFunc func(gc *gin.Context) error
+
+// Wrap convert HandlerFunc to gin.HandlerFunc, returned error is rendered as problem
+func Wrap(h HandlerFunc) gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		if err := h(gc); err != nil {
+			_ = gc.Error(err)
+			if !gc.Writer.Written() {
+				RenderError(gc, err)
+			}
+		}
+	}
+}
+
+type problemRender struct {
+	problem *Problem
+}
+
+// Render implements render.Render
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	content, err := json.Marshal(r.problem)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// WriteContentType implements render.Render
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ProblemContentType)
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max", "lte":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of [%s]", fe.Param())
+	case "email":
+		return "must be a valid email address"
+	}
+	if fe.Param() != "" {
+		return fmt.Sprintf("failed on %s=%s", fe.Tag(), fe.Param())
+	}
+	return fmt.Sprintf("failed on %s", fe.Tag())
+}
+
+// fieldPath strip the top level struct name from namespace
+func fieldPath(namespace string) string {
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func jsonFieldName(f reflect.StructField) string {
+	for _, tag := range []string{"json", "form", "uri", "header"} {
+		name := strings.SplitN(f.Tag.Get(tag), ",", 2)[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
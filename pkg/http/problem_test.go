@@ -0,0 +1,109 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errNotFound = errors.New("item is not found")
+
+type quotaError struct {
+	limit int
+}
+
+func (e *quotaError) Error() string {
+	return "quota exceeded"
+}
+
+type createItemRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Count int    `json:"count" binding:"min=1,max=10"`
+}
+
+func TestProblem(t *testing.T) {
+	DefaultErrorRegistry.Register(errNotFound, http.StatusNotFound, "https://peach.dev/problems/not-found", "")
+	RegisterErrorType[*quotaError](DefaultErrorRegistry, http.StatusForbidden, "", "Quota Exceeded")
+	UseJSONFieldNames()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/items", Wrap(func(gc *gin.Context) error {
+		var req createItemRequest
+		if err := gc.ShouldBindJSON(&req); err != nil {
+			return err
+		}
+		return &quotaError{limit: 1}
+	}))
+	r.GET("/items/:id", Wrap(func(gc *gin.Context) error {
+		return errNotFound
+	}))
+	r.GET("/boom", Wrap(func(gc *gin.Context) error {
+		return errors.New("database password is wrong")
+	}))
+	r.GET("/upstream", Wrap(func(gc *gin.Context) error {
+		return fmt.Errorf("dial 10.0.0.7:3306: %w", ErrBadGateway)
+	}))
+	r.GET("/corrupted", Wrap(func(gc *gin.Context) error {
+		var v map[string]interface{}
+		return json.Unmarshal([]byte("{cached"), &v)
+	}))
+
+	do := func(method string, path string, body string) (*httptest.ResponseRecorder, Problem) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var p Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatalf("failed to unmarshal problem %v", err)
+		}
+		if w.Header().Get("Content-Type") != ProblemContentType {
+			t.Fatalf("unexpected content type %s", w.Header().Get("Content-Type"))
+		}
+		return w, p
+	}
+
+	w, p := do(http.MethodPost, "/items", `{"count": 20}`)
+	if w.Code != http.StatusBadRequest || p.Status != http.StatusBadRequest {
+		t.Fatalf("validation: expect 400, actual %d", w.Code)
+	}
+	fields, ok := p.Extensions["errors"].([]interface{})
+	if !ok || len(fields) != 2 {
+		t.Fatalf("validation: expect 2 field errors, actual %v", p.Extensions)
+	}
+	if f := fields[0].(map[string]interface{}); f["field"] != "name" || f["rule"] != "required" {
+		t.Fatalf("validation: unexpected field error %v", f)
+	}
+
+	w, p = do(http.MethodPost, "/items", `{"name": "a", "count": 1}`)
+	if w.Code != http.StatusForbidden || p.Title != "Quota Exceeded" {
+		t.Fatalf("error type: unexpected problem %d %+v", w.Code, p)
+	}
+
+	w, p = do(http.MethodGet, "/items/1", "")
+	if w.Code != http.StatusNotFound || p.Type != "https://peach.dev/problems/not-found" || p.Instance != "/items/1" {
+		t.Fatalf("sentinel: unexpected problem %d %+v", w.Code, p)
+	}
+
+	w, p = do(http.MethodGet, "/boom", "")
+	if w.Code != http.StatusInternalServerError || p.Detail != "" {
+		t.Fatalf("unknown: unexpected problem %d %+v", w.Code, p)
+	}
+
+	w, p = do(http.MethodGet, "/upstream", "")
+	if w.Code != http.StatusBadGateway || p.Detail != ErrBadGateway.Error() {
+		t.Fatalf("wrapped 5xx: expect detail without internals, actual %d %+v", w.Code, p)
+	}
+
+	w, p = do(http.MethodGet, "/corrupted", "")
+	if w.Code != http.StatusInternalServerError || p.Detail != "" {
+		t.Fatalf("json error not from request: expect 500, actual %d %+v", w.Code, p)
+	}
+}
@@ -0,0 +1,432 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/af-go/peach-common/pkg/http/probe"
+	"github.com/gin-gonic/gin"
+	"github.com/go-logr/logr"
+)
+
+const (
+	BalancerRoundRobin       = "round-robin"
+	BalancerLeastConnections = "least-connections"
+
+	defaultHealthCheckInterval   = 10
+	defaultHealthCheckTimeout    = 2
+	defaultUnhealthyThreshold    = 3
+	defaultHealthyThreshold      = 2
+	defaultUpstreamHeaderTimeout = 30
+	defaultRetryBodyBytes        = 1 << 20
+	statusClientClosedRequest    = 499
+	proxyPathParam               = "proxyPath"
+)
+
+var ErrBadGateway = errors.New("upstream is unavailable")
+var ErrGatewayTimeout = errors.New("upstream did not respond in time")
+var ErrNoHealthyUpstream = errors.New("no healthy upstream")
+
+// ProxyOptions reverse proxy options
+type ProxyOptions struct {
+	Routes []ProxyRoute `json:"routes" yaml:"routes"`
+}
+
+// ProxyRoute requests under PathPrefix are proxied to one of Upstreams
+type ProxyRoute struct {
+	// PathPrefix e.g. /legacy, it must not overlap with other routes of the engine
+	PathPrefix string `json:"pathPrefix" yaml:"pathPrefix"`
+	// Upstreams base urls, e.g. http://10.0.0.1:8080/api, path of the base url is prepended to the request path
+	Upstreams []string `json:"upstreams" yaml:"upstreams"`
+	// Balancer round-robin or least-connections, default round-robin
+	Balancer string `json:"balancer" yaml:"balancer"`
+	// Rewrite replace PathPrefix of request path, e.g. /v1, "/" strips the prefix, empty keeps the path
+	Rewrite string `json:"rewrite" yaml:"rewrite"`
+	// RequestHeaders headers set on upstream requests
+	RequestHeaders map[string]string `json:"requestHeaders" yaml:"requestHeaders"`
+	// ResponseHeaders headers set on responses to clients
+	ResponseHeaders map[string]string `json:"responseHeaders" yaml:"responseHeaders"`
+	// PreserveHost send Host of client request instead of upstream host
+	PreserveHost bool `json:"preserveHost" yaml:"preserveHost"`
+	// Retries attempts on other upstreams when an idempotent request fails to connect or read response
+	Retries int `json:"retries" yaml:"retries"`
+	// MaxRetryBodyBytes max size of request bodies buffered for retries, larger requests are streamed and not retried, default 1MB
+	MaxRetryBodyBytes int64 `json:"maxRetryBodyBytes" yaml:"maxRetryBodyBytes"`
+	// Timeout seconds to wait for upstream response headers, default 30
+	Timeout     int               `json:"timeout" yaml:"timeout"`
+	HealthCheck *ProxyHealthCheck `json:"healthCheck,omitempty" yaml:"healthCheck,omitempty"`
+}
+
+// ProxyHealthCheck active health check of upstreams, unhealthy upstreams receive no requests
+type ProxyHealthCheck struct {
+	// Path probed on every upstream, e.g. /healthz
+	Path string `json:"path" yaml:"path"`
+	// Interval seconds between probes, default 10
+	Interval int `json:"interval" yaml:"interval"`
+	// Timeout seconds of a probe, default 2
+	Timeout int `json:"timeout" yaml:"timeout"`
+	// ExpectedStatus statuses of a healthy upstream, default any 2xx or 3xx
+	ExpectedStatus []int `json:"expectedStatus" yaml:"expectedStatus"`
+	// UnhealthyThreshold consecutive failures to mark upstream unhealthy, default 3
+	UnhealthyThreshold int `json:"unhealthyThreshold" yaml:"unhealthyThreshold"`
+	// HealthyThreshold consecutive successes to mark upstream healthy again, default 2
+	HealthyThreshold int `json:"healthyThreshold" yaml:"healthyThreshold"`
+}
+
+// NewProxyHandler create reverse proxy handler.
+// Routes are registered on the engine like other handlers, so server middleware such as auth, rate limits and access log apply.
+func NewProxyHandler(options ProxyOptions, logger *logr.Logger) (*ProxyHandler, error) {
+	h := ProxyHandler{logger: logger, stop: make(chan struct{})}
+	for _, o := range options.Routes {
+		route, err := newProxyRoute(o, logger)
+		if err != nil {
+			return nil, err
+		}
+		h.routes = append(h.routes, route)
+	}
+	return &h, nil
+}
+
+// ProxyHandler reverse proxy handler
+type ProxyHandler struct {
+	routes   []*proxyRoute
+	logger   *logr.Logger
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Build register proxy routes and start health checks
+func (h *ProxyHandler) Build(engine *gin.Engine) {
+	for _, r := range h.routes {
+		prefix := strings.TrimSuffix(r.options.PathPrefix, "/")
+		engine.Any(prefix+"/*"+proxyPathParam, r.serve)
+		if prefix != "" {
+			engine.Any(prefix, r.serve)
+		}
+		if r.options.HealthCheck != nil {
+			for _, u := range r.upstreams {
+				h.wg.Add(1)
+				go h.check(u, *r.options.HealthCheck)
+			}
+		}
+	}
+}
+
+// Stop stop health checks, Server.Stop calls it when the handler is served by Server
+func (h *ProxyHandler) Stop() {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+	h.wg.Wait()
+}
+
+func (h *ProxyHandler) check(u *upstream, options ProxyHealthCheck) {
+	defer h.wg.Done()
+	ticker := time.NewTicker(time.Duration(options.Interval) * time.Second)
+	defer ticker.Stop()
+	failures, successes := 0, 0
+	for {
+		if u.probe.Do() {
+			failures = 0
+			successes++
+			if !u.healthy.Load() && successes >= options.HealthyThreshold {
+				u.healthy.Store(true)
+				h.logger.Info("upstream is healthy", "upstream", u.target.String())
+			}
+		} else {
+			successes = 0
+			failures++
+			if u.healthy.Load() && failures >= options.UnhealthyThreshold {
+				u.healthy.Store(false)
+				h.logger.Info("upstream is unhealthy", "upstream", u.target.String())
+			}
+		}
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type ginContextKey struct{}
+
+type proxyRoute struct {
+	options   ProxyRoute
+	upstreams []*upstream
+	next      uint64
+	proxy     *httputil.ReverseProxy
+	logger    *logr.Logger
+}
+
+type upstream struct {
+	target   *url.URL
+	inflight int64
+	healthy  atomic.Bool
+	probe    probe.Probe
+}
+
+func newProxyRoute(options ProxyRoute, logger *logr.Logger) (*proxyRoute, error) {
+	if len(options.Upstreams) == 0 {
+		return nil, fmt.Errorf("no upstream of proxy route %s", options.PathPrefix)
+	}
+	if options.Balancer == "" {
+		options.Balancer = BalancerRoundRobin
+	}
+	if options.Balancer != BalancerRoundRobin && options.Balancer != BalancerLeastConnections {
+		return nil, fmt.Errorf("unknown balancer %s of proxy route %s", options.Balancer, options.PathPrefix)
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = defaultUpstreamHeaderTimeout
+	}
+	if options.MaxRetryBodyBytes <= 0 {
+		options.MaxRetryBodyBytes = defaultRetryBodyBytes
+	}
+	if options.HealthCheck != nil {
+		hc := *options.HealthCheck
+		options.HealthCheck = &hc
+		if hc.Interval <= 0 {
+			hc.Interval = defaultHealthCheckInterval
+		}
+		if hc.Timeout <= 0 {
+			hc.Timeout = defaultHealthCheckTimeout
+		}
+		if hc.UnhealthyThreshold <= 0 {
+			hc.UnhealthyThreshold = defaultUnhealthyThreshold
+		}
+		if hc.HealthyThreshold <= 0 {
+			hc.HealthyThreshold = defaultHealthyThreshold
+		}
+	}
+	r := proxyRoute{options: options, logger: logger}
+	for _, raw := range options.Upstreams {
+		target, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if target.Scheme != "http" && target.Scheme != "https" || target.Host == "" {
+			return nil, fmt.Errorf("invalid upstream %s of proxy route %s", raw, options.PathPrefix)
+		}
+		u := upstream{target: target}
+		u.healthy.Store(true)
+		if hc := options.HealthCheck; hc != nil {
+			u.probe = probe.BuildHTTPProbe(probe.HTTPProbeOptions{
+				URL:            singleJoiningSlash(target.String(), hc.Path),
+				ExpectedStatus: hc.ExpectedStatus,
+				Timeout:        hc.Timeout,
+			}, logger)
+		}
+		r.upstreams = append(r.upstreams, &u)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = time.Duration(options.Timeout) * time.Second
+	r.proxy = &httputil.ReverseProxy{
+		Rewrite:        r.rewrite,
+		Transport:      &upstreamTransport{route: &r, base: transport},
+		ModifyResponse: r.modifyResponse,
+		ErrorHandler:   r.handleError,
+	}
+	return &r, nil
+}
+
+func (r *proxyRoute) serve(gc *gin.Context) {
+	req := gc.Request
+	if r.options.Retries > 0 && isRetryable(req) {
+		// buffer body so it can be sent again to another upstream
+		body, ok, err := readBody(req, r.options.MaxRetryBodyBytes)
+		if err != nil {
+			abortWithError(gc, http.StatusBadRequest, err)
+			return
+		}
+		// larger bodies are streamed and not retried
+		if ok {
+			req.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
+			}
+		}
+	}
+	r.proxy.ServeHTTP(gc.Writer, req.WithContext(context.WithValue(req.Context(), ginContextKey{}, gc)))
+}
+
+// rewrite rewrite path and set headers, the upstream is chosen by upstreamTransport
+func (r *proxyRoute) rewrite(pr *httputil.ProxyRequest) {
+	pr.SetXForwarded()
+	if r.options.Rewrite != "" {
+		rest := strings.TrimPrefix(pr.In.URL.Path, strings.TrimSuffix(r.options.PathPrefix, "/"))
+		pr.Out.URL.Path = singleJoiningSlash(r.options.Rewrite, rest)
+		pr.Out.URL.RawPath = ""
+	}
+	for k, v := range r.options.RequestHeaders {
+		pr.Out.Header.Set(k, v)
+	}
+}
+
+func (r *proxyRoute) modifyResponse(resp *http.Response) error {
+	for k, v := range r.options.ResponseHeaders {
+		resp.Header.Set(k, v)
+	}
+	return nil
+}
+
+func (r *proxyRoute) handleError(w http.ResponseWriter, req *http.Request, err error) {
+	gc, _ := req.Context().Value(ginContextKey{}).(*gin.Context)
+	if errors.Is(err, context.Canceled) {
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+	r.logger.Error(err, "failed to proxy request", "prefix", r.options.PathPrefix, "path", req.URL.Path)
+	httpMetrics.Add("proxy_errors", 1)
+	var ne net.Error
+	switch {
+	case errors.Is(err, ErrNoHealthyUpstream):
+		err = ErrNoHealthyUpstream
+	case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &ne) && ne.Timeout():
+		err = ErrGatewayTimeout
+	default:
+		err = ErrBadGateway
+	}
+	if gc == nil {
+		http.Error(w, err.Error(), DefaultErrorRegistry.Problem(err).Status)
+		return
+	}
+	RenderError(gc, err)
+}
+
+// pick choose a healthy upstream not tried yet
+func (r *proxyRoute) pick(tried map[*upstream]bool) *upstream {
+	n := len(r.upstreams)
+	start := int(atomic.AddUint64(&r.next, 1) % uint64(n))
+	var chosen *upstream
+	for i := 0; i < n; i++ {
+		u := r.upstreams[(start+i)%n]
+		if tried[u] || !u.healthy.Load() {
+			continue
+		}
+		if r.options.Balancer == BalancerRoundRobin {
+			return u
+		}
+		if chosen == nil || atomic.LoadInt64(&u.inflight) < atomic.LoadInt64(&chosen.inflight) {
+			chosen = u
+		}
+	}
+	return chosen
+}
+
+// upstreamTransport send request to an upstream picked by the balancer, retry idempotent requests on other upstreams
+type upstreamTransport struct {
+	route *proxyRoute
+	base  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retries := 0
+	if isRetryable(req) && (req.Body == nil || req.Body == http.NoBody || req.GetBody != nil) {
+		retries = t.route.options.Retries
+	}
+	tried := make(map[*upstream]bool)
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		u := t.route.pick(tried)
+		if u == nil {
+			break
+		}
+		tried[u] = true
+		out := req.Clone(req.Context())
+		out.URL.Scheme = u.target.Scheme
+		out.URL.Host = u.target.Host
+		out.URL.Path = singleJoiningSlash(u.target.Path, req.URL.Path)
+		out.URL.RawPath = ""
+		if !t.route.options.PreserveHost {
+			out.Host = u.target.Host
+		}
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			out.Body = body
+		}
+		atomic.AddInt64(&u.inflight, 1)
+		resp, err := t.base.RoundTrip(out)
+		if err == nil {
+			body := &upstreamBody{ReadCloser: resp.Body, upstream: u}
+			resp.Body = body
+			// the proxy copies both ways over the body of a switched protocol, e.g. websocket
+			if rwc, ok := body.ReadCloser.(io.ReadWriteCloser); ok && resp.StatusCode == http.StatusSwitchingProtocols {
+				resp.Body = &upstreamConn{upstreamBody: body, conn: rwc}
+			}
+			return resp, nil
+		}
+		atomic.AddInt64(&u.inflight, -1)
+		lastErr = err
+		if req.Context().Err() != nil {
+			break
+		}
+		if attempt < retries {
+			httpMetrics.Add("proxy_retries", 1)
+			t.route.logger.V(1).Info("retry request on another upstream", "upstream", u.target.String(), "err", err.Error())
+		}
+	}
+	if lastErr == nil {
+		return nil, ErrNoHealthyUpstream
+	}
+	return nil, lastErr
+}
+
+// upstreamBody release in-flight count of upstream when the response body is closed
+type upstreamBody struct {
+	io.ReadCloser
+	upstream *upstream
+	once     sync.Once
+}
+
+func (b *upstreamBody) Close() error {
+	b.once.Do(func() {
+		atomic.AddInt64(&b.upstream.inflight, -1)
+	})
+	return b.ReadCloser.Close()
+}
+
+// upstreamConn upstreamBody of a switched protocol, writable as the connection to upstream
+type upstreamConn struct {
+	*upstreamBody
+	conn io.ReadWriteCloser
+}
+
+func (c *upstreamConn) Write(data []byte) (int, error) {
+	return c.conn.Write(data)
+}
+
+// isRetryable whether request can be sent again, idempotent methods or requests with idempotency key
+func isRetryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(defaultIdempotencyHeader) != ""
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash && b != "":
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -0,0 +1,199 @@
+package http
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/af-go/peach-common/pkg/log"
+	"github.com/gin-gonic/gin"
+)
+
+func newUpstream(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Upstream", name)
+		w.Header().Set("X-Upstream-Host", r.Host)
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.Path + " " + r.Header.Get("X-Gateway") + " " + string(body)))
+	}))
+}
+
+// closeNotifyRecorder gin writer of a recorder panics on CloseNotify used by httputil.ReverseProxy
+type closeNotifyRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (r closeNotifyRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func serveProxy(r *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(closeNotifyRecorder{w}, req)
+	return w
+}
+
+func TestProxyHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := newUpstream("a")
+	defer a.Close()
+	dead := newUpstream("dead")
+	dead.Close()
+
+	h, err := NewProxyHandler(ProxyOptions{Routes: []ProxyRoute{{
+		PathPrefix:      "/legacy",
+		Upstreams:       []string{dead.URL, a.URL + "/api"},
+		Rewrite:         "/v1",
+		RequestHeaders:  map[string]string{"X-Gateway": "peach"},
+		ResponseHeaders: map[string]string{"X-Proxied": "true"},
+		Retries:         1,
+	}, {
+		PathPrefix:        "/large",
+		Upstreams:         []string{dead.URL, a.URL},
+		Retries:           1,
+		MaxRetryBodyBytes: 4,
+	}, {
+		PathPrefix:   "/preserved",
+		Upstreams:    []string{a.URL},
+		PreserveHost: true,
+	}}}, log.NewLogger(false))
+	if err != nil {
+		t.Fatalf("failed to create proxy handler %v", err)
+	}
+	r := gin.New()
+	h.Build(r)
+	defer h.Stop()
+
+	for i := 0; i < 4; i++ {
+		w := serveProxy(r, httptest.NewRequest(http.MethodPut, "/legacy/users/1", strings.NewReader("pear")))
+		if w.Code != http.StatusOK || w.Body.String() != "PUT /api/v1/users/1 peach pear" || w.Header().Get("X-Proxied") != "true" {
+			t.Fatalf("expect idempotent request retried on healthy upstream, actual %d %s", w.Code, w.Body.String())
+		}
+	}
+	w := serveProxy(r, httptest.NewRequest(http.MethodGet, "http://gateway.local/legacy/users/1", nil))
+	if host := w.Header().Get("X-Upstream-Host"); host != strings.TrimPrefix(a.URL, "http://") {
+		t.Fatalf("expect upstream host sent, actual %s", host)
+	}
+	w = serveProxy(r, httptest.NewRequest(http.MethodGet, "http://gateway.local/preserved/users/1", nil))
+	if host := w.Header().Get("X-Upstream-Host"); host != "gateway.local" {
+		t.Fatalf("expect client host preserved, actual %s", host)
+	}
+	failed := 0
+	for i := 0; i < 4; i++ {
+		w := serveProxy(r, httptest.NewRequest(http.MethodPost, "/legacy/users", strings.NewReader("pear")))
+		if w.Code == http.StatusBadGateway {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Fatalf("expect post is not retried, actual %d of 4 requests failed", failed)
+	}
+	failed = 0
+	for i := 0; i < 4; i++ {
+		w := serveProxy(r, httptest.NewRequest(http.MethodPut, "/large/users/1", strings.NewReader("apple")))
+		switch {
+		case w.Code == http.StatusBadGateway:
+			failed++
+		case w.Body.String() != "PUT /large/users/1  apple":
+			t.Fatalf("expect whole body proxied, actual %s", w.Body.String())
+		}
+	}
+	if failed != 2 {
+		t.Fatalf("expect body larger than MaxRetryBodyBytes is not retried, actual %d of 4 requests failed", failed)
+	}
+}
+
+func TestProxyUpgrade(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		_ = rw.Flush()
+		_, _ = io.Copy(conn, rw)
+	}))
+	defer upstream.Close()
+	h, err := NewProxyHandler(ProxyOptions{Routes: []ProxyRoute{{PathPrefix: "/ws", Upstreams: []string{upstream.URL}}}}, log.NewLogger(false))
+	if err != nil {
+		t.Fatalf("failed to create proxy handler %v", err)
+	}
+	r := gin.New()
+	h.Build(r)
+	defer h.Stop()
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(gateway.URL, "http://"))
+	if err != nil {
+		t.Fatalf("failed to connect gateway %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, _ = conn.Write([]byte("GET /ws/echo HTTP/1.1\r\nHost: gateway\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expect 101, actual %v %v", resp, err)
+	}
+	_, _ = conn.Write([]byte("ping"))
+	echoed := make([]byte, 4)
+	if _, err := io.ReadFull(br, echoed); err != nil || string(echoed) != "ping" {
+		t.Fatalf("expect upgraded connection proxied both ways, actual %q %v", echoed, err)
+	}
+}
+
+func TestProxyHealthCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := newUpstream("a")
+	defer a.Close()
+	b := newUpstream("b")
+	defer b.Close()
+	dead := newUpstream("dead")
+	dead.Close()
+
+	h, err := NewProxyHandler(ProxyOptions{Routes: []ProxyRoute{{
+		PathPrefix:  "/svc",
+		Upstreams:   []string{a.URL, dead.URL, b.URL},
+		Balancer:    BalancerLeastConnections,
+		HealthCheck: &ProxyHealthCheck{Path: "/healthz", Interval: 1, UnhealthyThreshold: 1},
+	}, {
+		PathPrefix:  "/down",
+		Upstreams:   []string{dead.URL},
+		HealthCheck: &ProxyHealthCheck{Path: "/healthz", Interval: 1, UnhealthyThreshold: 1},
+	}}}, log.NewLogger(false))
+	if err != nil {
+		t.Fatalf("failed to create proxy handler %v", err)
+	}
+	r := gin.New()
+	h.Build(r)
+	defer h.Stop()
+	time.Sleep(200 * time.Millisecond)
+
+	seen := map[string]bool{}
+	for i := 0; i < 6; i++ {
+		w := serveProxy(r, httptest.NewRequest(http.MethodPost, "/svc", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expect unhealthy upstream is skipped, actual %d %s", w.Code, w.Body.String())
+		}
+		seen[w.Header().Get("X-Upstream")] = true
+	}
+	if !seen["a"] || !seen["b"] {
+		t.Fatalf("expect requests balanced over healthy upstreams, actual %v", seen)
+	}
+	w := serveProxy(r, httptest.NewRequest(http.MethodGet, "/down/x", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expect 503 without healthy upstream, actual %d", w.Code)
+	}
+}
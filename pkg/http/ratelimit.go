@@ -0,0 +1,289 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+)
+
+const (
+	KeyByIP        = "ip"
+	KeyByAPIKey    = "apikey"
+	KeyByPrincipal = "principal"
+
+	limiterIdleTimeout = 10 * time.Minute
+	maxLimiterClients  = 100000
+	overflowClientKey  = "overflow"
+)
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+var ErrOverloaded = errors.New("server is overloaded")
+
+// RateLimitOptions rate limit and load shedding options
+type RateLimitOptions struct {
+	// MaxConcurrent global in-flight requests limit, 0 means unlimited
+	MaxConcurrent int `json:"maxConcurrent" yaml:"maxConcurrent"`
+	// QueueTimeout milliseconds to wait for an in-flight slot before shedding with 503
+	QueueTimeout int `json:"queueTimeout" yaml:"queueTimeout"`
+	// RetryAfter seconds suggested to shed clients, default 1
+	RetryAfter int `json:"retryAfter" yaml:"retryAfter"`
+	// ExemptPaths paths never shed or limited, e.g. /healthz
+	ExemptPaths []string `json:"exemptPaths" yaml:"exemptPaths"`
+	// IPRate requests per second per client ip over all routes, it is checked before authentication so credential guessing is limited, 0 means unlimited
+	IPRate float64 `json:"ipRate" yaml:"ipRate"`
+	// IPBurst burst of IPRate, default IPRate rounded up
+	IPBurst int              `json:"ipBurst" yaml:"ipBurst"`
+	Groups  []RouteRateLimit `json:"groups" yaml:"groups"`
+}
+
+// RouteRateLimit limits of a route group, the group with the longest matched prefix applies
+type RouteRateLimit struct {
+	PathPrefix string `json:"pathPrefix" yaml:"pathPrefix"`
+	// KeyBy ip, apikey or principal, default ip. Clients not authenticated by api key or at all are keyed by ip
+	KeyBy string `json:"keyBy" yaml:"keyBy"`
+	// APIKeyHeader header holds api key when KeyBy is apikey, default X-API-Key
+	APIKeyHeader string `json:"apiKeyHeader" yaml:"apiKeyHeader"`
+	// Rate requests per second per client, 0 means unlimited
+	Rate  float64 `json:"rate" yaml:"rate"`
+	Burst int     `json:"burst" yaml:"burst"`
+	// MaxConcurrent in-flight requests limit of the group, 0 means unlimited
+	MaxConcurrent int `json:"maxConcurrent" yaml:"maxConcurrent"`
+}
+
+// Enabled whether any limit is configured
+func (o RateLimitOptions) Enabled() bool {
+	return o.MaxConcurrent > 0 || o.IPRate > 0 || len(o.Groups) > 0
+}
+
+// NewLoadShedder create middleware which limits in-flight requests globally, rejects with 503 when overloaded
+func NewLoadShedder(options RateLimitOptions, logger *logr.Logger) gin.HandlerFunc {
+	slots := make(chan struct{}, options.MaxConcurrent)
+	timeout := time.Duration(options.QueueTimeout) * time.Millisecond
+	retryAfter := options.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = 1
+	}
+	return func(gc *gin.Context) {
+		if isExempt(options.ExemptPaths, gc.Request.URL.Path) {
+			gc.Next()
+			return
+		}
+		if !acquire(slots, timeout) {
+			logger.Info("request is shed", "path", gc.Request.URL.Path, "client", gc.ClientIP(), "inflight", len(slots))
+			httpMetrics.Add("shed", 1)
+			gc.Header("Retry-After", strconv.Itoa(retryAfter))
+			abortWithError(gc, http.StatusServiceUnavailable, ErrOverloaded)
+			return
+		}
+		defer func() { <-slots }()
+		gc.Next()
+	}
+}
+
+// NewRateLimiter create middleware which applies the per ip limit, per route group and per client limits, rejects with 429 or 503.
+// It should be installed after the auth middleware when keyed by api key or principal, Server checks the per ip limit and groups
+// keyed by ip before authentication instead.
+func NewRateLimiter(options RateLimitOptions, logger *logr.Logger) gin.HandlerFunc {
+	return newRateLimiter(options, logger, true, true)
+}
+
+// newRateLimiter create middleware of the per ip limit and the groups keyed by authenticated client or by ip, the group with
+// the longest matched prefix is chosen among all groups and only applies if it is of the selected kind
+func newRateLimiter(options RateLimitOptions, logger *logr.Logger, authenticated bool, others bool) gin.HandlerFunc {
+	groups := []*groupLimiter{}
+	for _, g := range options.Groups {
+		groups = append(groups, newGroupLimiter(g))
+	}
+	var ip *groupLimiter
+	if options.IPRate > 0 && others {
+		ip = newGroupLimiter(RouteRateLimit{KeyBy: KeyByIP, Rate: options.IPRate, Burst: options.IPBurst})
+	}
+	retryAfter := options.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = 1
+	}
+	return func(gc *gin.Context) {
+		path := gc.Request.URL.Path
+		if isExempt(options.ExemptPaths, path) {
+			gc.Next()
+			return
+		}
+		if ip != nil && !ip.allow(gc, logger) {
+			return
+		}
+		g := matchGroup(groups, path)
+		if g == nil || g.authenticated() && !authenticated || !g.authenticated() && !others {
+			gc.Next()
+			return
+		}
+		if g.limit.Rate > 0 && !g.allow(gc, logger) {
+			return
+		}
+		if g.slots != nil {
+			if !acquire(g.slots, 0) {
+				logger.Info("request is shed", "group", g.limit.PathPrefix, "client", gc.ClientIP())
+				httpMetrics.Add("shed:"+g.limit.PathPrefix, 1)
+				gc.Header("Retry-After", strconv.Itoa(retryAfter))
+				abortWithError(gc, http.StatusServiceUnavailable, ErrOverloaded)
+				return
+			}
+			defer func() { <-g.slots }()
+		}
+		gc.Next()
+	}
+}
+
+// allow take a token for the client of request, the request is rejected with 429 when none is available
+func (g *groupLimiter) allow(gc *gin.Context, logger *logr.Logger) bool {
+	key := g.key(gc)
+	delay := g.reserve(key)
+	if delay <= 0 {
+		return true
+	}
+	logger.Info("request is rate limited", "group", g.limit.PathPrefix, "key", key, "retryAfter", delay.String())
+	httpMetrics.Add("ratelimited:"+g.limit.PathPrefix, 1)
+	gc.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+	abortWithError(gc, http.StatusTooManyRequests, ErrRateLimited)
+	return false
+}
+
+func newGroupLimiter(limit RouteRateLimit) *groupLimiter {
+	g := groupLimiter{limit: limit, clients: make(map[string]*clientLimiter), lastSweep: time.Now()}
+	if g.limit.Burst <= 0 {
+		g.limit.Burst = int(math.Max(1, math.Ceil(limit.Rate)))
+	}
+	if g.limit.APIKeyHeader == "" {
+		g.limit.APIKeyHeader = defaultAPIKeyHeader
+	}
+	if limit.MaxConcurrent > 0 {
+		g.slots = make(chan struct{}, limit.MaxConcurrent)
+	}
+	return &g
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+type groupLimiter struct {
+	limit     RouteRateLimit
+	slots     chan struct{}
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+// authenticated whether clients of the group are keyed by their authenticated identity
+func (g *groupLimiter) authenticated() bool {
+	return g.limit.KeyBy == KeyByAPIKey || g.limit.KeyBy == KeyByPrincipal
+}
+
+// key identify the client, fall back to ip when the request is not authenticated by the configured identity,
+// so unauthenticated clients cannot get a fresh limit by sending another key. api keys are hashed, keys are logged
+func (g *groupLimiter) key(gc *gin.Context) string {
+	p, ok := GetPrincipal(gc)
+	switch {
+	case g.limit.KeyBy == KeyByAPIKey && ok && p.Method == "apikey":
+		if k := gc.GetHeader(g.limit.APIKeyHeader); k != "" {
+			sum := sha256.Sum256([]byte(k))
+			return "apikey:" + hex.EncodeToString(sum[:8])
+		}
+	case g.limit.KeyBy == KeyByPrincipal && ok:
+		return fmt.Sprintf("%s:%s", p.Method, p.Subject)
+	}
+	return "ip:" + gc.ClientIP()
+}
+
+// reserve take a token for the client, return how long the client should wait when none is available
+func (g *groupLimiter) reserve(key string) time.Duration {
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Sub(g.lastSweep) > limiterIdleTimeout {
+		g.sweep(now)
+	}
+	c, ok := g.clients[key]
+	if !ok && len(g.clients) >= maxLimiterClients {
+		if now.Sub(g.lastSweep) > time.Second {
+			g.sweep(now)
+		}
+		// new clients share one limiter until idle clients are removed
+		if len(g.clients) >= maxLimiterClients {
+			key = overflowClientKey
+			c, ok = g.clients[key]
+		}
+	}
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(rate.Limit(g.limit.Rate), g.limit.Burst)}
+		g.clients[key] = c
+	}
+	c.lastSeen = now
+	r := c.limiter.ReserveN(now, 1)
+	if !r.OK() {
+		return time.Second
+	}
+	delay := r.DelayFrom(now)
+	if delay > 0 {
+		r.CancelAt(now)
+	}
+	return delay
+}
+
+func (g *groupLimiter) sweep(now time.Time) {
+	for k, c := range g.clients {
+		if now.Sub(c.lastSeen) > limiterIdleTimeout {
+			delete(g.clients, k)
+		}
+	}
+	g.lastSweep = now
+}
+
+func matchGroup(groups []*groupLimiter, path string) *groupLimiter {
+	var matched *groupLimiter
+	for _, g := range groups {
+		if strings.HasPrefix(path, g.limit.PathPrefix) && (matched == nil || len(g.limit.PathPrefix) > len(matched.limit.PathPrefix)) {
+			matched = g
+		}
+	}
+	return matched
+}
+
+func acquire(slots chan struct{}, timeout time.Duration) bool {
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if timeout <= 0 {
+		return false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func isExempt(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/af-go/peach-common/pkg/log"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiter(t *testing.T) {
+	logger := log.NewLogger(true)
+	options := RateLimitOptions{
+		ExemptPaths: []string{"/api/healthz"},
+		Groups: []RouteRateLimit{
+			{PathPrefix: "/api", KeyBy: KeyByAPIKey, Rate: 0.5, Burst: 2},
+			{PathPrefix: "/api/bulk", Rate: 0.5, Burst: 1},
+		},
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(gc *gin.Context) {
+		if k := gc.GetHeader("X-API-Key"); k != "" && k != "forged" {
+			gc.Set(principalKey, &Principal{Subject: k, Method: "apikey"})
+		}
+	})
+	r.Use(NewRateLimiter(options, logger))
+	ok := func(gc *gin.Context) { gc.JSON(200, StatusResponse{Message: "ok"}) }
+	r.GET("/api/items", ok)
+	r.GET("/api/bulk", ok)
+	r.GET("/api/healthz", ok)
+
+	do := func(path string, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := do("/api/items", "a"); w.Code != 200 {
+			t.Fatalf("request %d: expect 200, actual %d", i, w.Code)
+		}
+	}
+	w := do("/api/items", "a")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expect 429, actual %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("expect Retry-After 2, actual %q", w.Header().Get("Retry-After"))
+	}
+	if w := do("/api/items", "b"); w.Code != 200 {
+		t.Fatalf("another client: expect 200, actual %d", w.Code)
+	}
+	for i := 0; i < 2; i++ {
+		if w := do("/api/items", "forged"); w.Code != 200 {
+			t.Fatalf("unauthenticated request %d: expect 200, actual %d", i, w.Code)
+		}
+	}
+	if w := do("/api/items", ""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expect unauthenticated requests limited by ip whatever key is sent, actual %d", w.Code)
+	}
+	if w := do("/api/bulk", "a"); w.Code != 200 {
+		t.Fatalf("longest prefix group: expect 200, actual %d", w.Code)
+	}
+	if w := do("/api/bulk", "a"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("longest prefix group: expect 429, actual %d", w.Code)
+	}
+	for i := 0; i < 5; i++ {
+		if w := do("/api/healthz", "a"); w.Code != 200 {
+			t.Fatalf("exempt path: expect 200, actual %d", w.Code)
+		}
+	}
+}
+
+func TestRateLimiterBeforeAuth(t *testing.T) {
+	logger := log.NewLogger(false)
+	options := RateLimitOptions{
+		IPRate:  0.5,
+		IPBurst: 2,
+		Groups:  []RouteRateLimit{{PathPrefix: "/api", KeyBy: KeyByPrincipal, Rate: 100}},
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(newRateLimiter(options, logger, false, true))
+	r.Use(func(gc *gin.Context) {
+		if gc.GetHeader("Authorization") != "Bearer good" {
+			abortWithError(gc, http.StatusUnauthorized, ErrUnauthenticated)
+			return
+		}
+		gc.Next()
+	})
+	r.Use(newRateLimiter(options, logger, true, false))
+	r.GET("/api/items", func(gc *gin.Context) { gc.JSON(200, StatusResponse{Message: "ok"}) })
+
+	do := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/items", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := do("guess"); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: expect 401, actual %d", i, code)
+		}
+	}
+	if code := do("guess"); code != http.StatusTooManyRequests {
+		t.Fatalf("expect failed authentication attempts limited by ip, actual %d", code)
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	g := newGroupLimiter(RouteRateLimit{KeyBy: KeyByAPIKey, Rate: 1})
+	gin.SetMode(gin.TestMode)
+	gc, _ := gin.CreateTestContext(httptest.NewRecorder())
+	gc.Request = httptest.NewRequest(http.MethodGet, "/api/items", nil)
+	gc.Request.Header.Set("X-API-Key", "secret-key")
+	if key := g.key(gc); key != "ip:"+gc.ClientIP() {
+		t.Fatalf("expect unauthenticated request keyed by ip, actual %s", key)
+	}
+	gc.Set(principalKey, &Principal{Subject: "ci", Method: "apikey"})
+	if key := g.key(gc); !strings.HasPrefix(key, "apikey:") || strings.Contains(key, "secret-key") {
+		t.Fatalf("expect hashed api key, actual %s", key)
+	}
+	for i := 0; i < maxLimiterClients+10; i++ {
+		g.reserve(fmt.Sprintf("ip:%d", i))
+	}
+	if len(g.clients) > maxLimiterClients+1 {
+		t.Fatalf("expect clients capped, actual %d", len(g.clients))
+	}
+}
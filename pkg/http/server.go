@@ -2,27 +2,89 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/gin-contrib/pprof"
 	"github.com/gin-gonic/gin"
 	"github.com/go-logr/logr"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	defaultServerReadHeaderTimeout = 10
+	defaultServerReadTimeout       = 60
+	defaultServerWriteTimeout      = 60
+	defaultServerIdleTimeout       = 120
+	defaultServerShutdownTimeout   = 30
 )
 
 type Handler interface {
 	Build(engine *gin.Engine)
 }
 
+// Stopper handler with background work, e.g. health checks of ProxyHandler, it is stopped by Server.Stop
+type Stopper interface {
+	Stop()
+}
+
 // Options http server options
 type ServerOptions struct {
-	Host            string `json:"host" yaml:"host"`
-	Port            int    `json:"port" yaml:"port"`
-	CAFile          string `json:"caFile" yaml:"caFile"`
-	PrivateKeyFile  string `json:"privateKetFile" yaml:"privateKeyFile"`
-	PublicCertFile  string `json:"publicCertFile" yaml:"publicCertFile"`
-	EnableProfiling bool   `json:"enableProfiling" yaml:"enableProfiling"`
+	Host            string           `json:"host" yaml:"host"`
+	Port            int              `json:"port" yaml:"port"`
+	CAFile          string           `json:"caFile" yaml:"caFile"`
+	PrivateKeyFile  string           `json:"privateKetFile" yaml:"privateKeyFile"`
+	PublicCertFile  string           `json:"publicCertFile" yaml:"publicCertFile"`
+	EnableProfiling bool             `json:"enableProfiling" yaml:"enableProfiling"`
+	EnableMetrics   bool             `json:"enableMetrics" yaml:"enableMetrics"`
+	Auth            AuthOptions      `json:"auth" yaml:"auth"`
+	RateLimit       RateLimitOptions `json:"rateLimit" yaml:"rateLimit"`
+	OpenAPI         *OpenAPIOptions  `json:"openapi,omitempty" yaml:"openapi,omitempty"`
+	// Session load and save sessions of the session cookie, see GetSession
+	Session *SessionOptions `json:"session,omitempty" yaml:"session,omitempty"`
+	// CSRF reject unsafe form requests without csrf token, double-submit mode requires KeysEnvVar and session mode requires Session
+	CSRF *CSRFOptions `json:"csrf,omitempty" yaml:"csrf,omitempty"`
+	// Idempotency replay responses of retried POST and PATCH requests with Idempotency-Key
+	Idempotency *IdempotencyOptions `json:"idempotency,omitempty" yaml:"idempotency,omitempty"`
+	// ReadHeaderTimeout seconds to read request headers, default 10, negative means no timeout
+	ReadHeaderTimeout int `json:"readHeaderTimeout" yaml:"readHeaderTimeout"`
+	// ReadTimeout seconds to read the entire request, default 60, negative means no timeout
+	ReadTimeout int `json:"readTimeout" yaml:"readTimeout"`
+	// WriteTimeout seconds to write the response, default 60, negative means no timeout, e.g. for server sent events
+	WriteTimeout int `json:"writeTimeout" yaml:"writeTimeout"`
+	// IdleTimeout seconds to keep idle connections alive, default 120, negative means no timeout
+	IdleTimeout int `json:"idleTimeout" yaml:"idleTimeout"`
+	// MaxHeaderBytes max size of request headers, default 1MB
+	MaxHeaderBytes int `json:"maxHeaderBytes" yaml:"maxHeaderBytes"`
+	// ShutdownTimeout seconds Stop waits for in-flight requests, default 30
+	ShutdownTimeout int `json:"shutdownTimeout" yaml:"shutdownTimeout"`
+	// JSONFieldNames report json field names instead of go struct field names in validation errors, see UseJSONFieldNames
+	JSONFieldNames bool `json:"jsonFieldNames" yaml:"jsonFieldNames"`
+	// HTTP2 http/2 settings, http/2 is negotiated by TLS ALPN, or served in cleartext if H2C is enabled
+	HTTP2 *HTTP2Options `json:"http2,omitempty" yaml:"http2,omitempty"`
+}
+
+// HTTP2Options http/2 server options
+type HTTP2Options struct {
+	// H2C serve http/2 without TLS, prior knowledge and Upgrade: h2c are both accepted, e.g. behind a L4 load balancer
+	H2C bool `json:"h2c" yaml:"h2c"`
+	// MaxConcurrentStreams concurrent streams per connection, default 250
+	MaxConcurrentStreams uint32 `json:"maxConcurrentStreams" yaml:"maxConcurrentStreams"`
+	// MaxReadFrameSize largest frame accepted, default 1MB
+	MaxReadFrameSize uint32 `json:"maxReadFrameSize" yaml:"maxReadFrameSize"`
+	// IdleTimeout seconds to close idle connections, default is IdleTimeout of server
+	IdleTimeout int `json:"idleTimeout" yaml:"idleTimeout"`
+	// MaxUploadBufferPerConnection flow control window of a connection, default 1MB
+	MaxUploadBufferPerConnection int32 `json:"maxUploadBufferPerConnection" yaml:"maxUploadBufferPerConnection"`
+	// MaxUploadBufferPerStream flow control window of a stream, default 1MB
+	MaxUploadBufferPerStream int32 `json:"maxUploadBufferPerStream" yaml:"maxUploadBufferPerStream"`
 }
 
 // NewServer create new Server
@@ -38,43 +100,190 @@ type Server struct {
 	handlers []Handler
 }
 
-// Start start http Server
+// Start start http Server, the server is not started and the error is logged if its middleware or tls config can't be built
 func (c *Server) Start(ctx context.Context) {
+	if err := c.Run(ctx); err != nil {
+		c.logger.Error(err, "failed to start Server")
+	}
+}
+
+// Run start http Server like Start and return immediately, the error is returned if the server can't be started
+func (c *Server) Run(ctx context.Context) error {
 	gin.SetMode(gin.ReleaseMode)
 	port := c.options.Port
 	if port == 0 {
 		port = 8080
 	}
+	if c.options.JSONFieldNames {
+		UseJSONFieldNames()
+	}
+	var tlsConfig *tls.Config
+	tlsEnabled := c.options.PublicCertFile != "" && c.options.PrivateKeyFile != ""
+	if tlsEnabled {
+		var err error
+		if tlsConfig, err = c.buildTLSConfig(); err != nil {
+			return fmt.Errorf("failed to build tls config: %w", err)
+		}
+	}
 	r := gin.Default()
+	if c.options.RateLimit.MaxConcurrent > 0 {
+		r.Use(NewLoadShedder(c.options.RateLimit, c.logger))
+	}
+	if c.options.RateLimit.Enabled() {
+		// limit credential guessing, only groups keyed by api key or principal wait for authentication
+		r.Use(newRateLimiter(c.options.RateLimit, c.logger, false, true))
+	}
+	if c.options.Session != nil {
+		session, err := BuildSessionMiddleware(*c.options.Session, c.logger)
+		if err != nil {
+			return fmt.Errorf("failed to build session middleware: %w", err)
+		}
+		r.Use(session)
+	}
+	if c.options.Auth.Enabled() {
+		authenticators, err := BuildAuthenticators(c.options.Auth, c.logger)
+		if err != nil {
+			return fmt.Errorf("failed to build authenticators: %w", err)
+		}
+		r.Use(NewAuthMiddleware(c.logger, authenticators...))
+	}
+	if c.options.CSRF != nil {
+		csrf, err := BuildCSRFMiddleware(*c.options.CSRF, c.logger)
+		if err != nil {
+			return fmt.Errorf("failed to build csrf middleware: %w", err)
+		}
+		r.Use(csrf)
+	}
+	if c.options.RateLimit.Enabled() {
+		r.Use(newRateLimiter(c.options.RateLimit, c.logger, true, false))
+	}
+	if c.options.Idempotency != nil {
+		store, err := BuildIdempotencyStore(*c.options.Idempotency)
+		if err != nil {
+			return fmt.Errorf("failed to build idempotency store: %w", err)
+		}
+		r.Use(NewIdempotencyMiddleware(*c.options.Idempotency, store, c.logger))
+	}
+	var openapi *OpenAPIHandler
+	if c.options.OpenAPI != nil {
+		openapi = NewOpenAPIHandler(*c.options.OpenAPI, c.handlers...)
+		if c.options.OpenAPI.ValidateRequests {
+			r.Use(openapi.RequestValidator())
+		}
+	}
 	for _, h := range c.handlers {
 		h.Build(r)
 	}
+	if openapi != nil {
+		openapi.Build(r)
+	}
 	if c.options.EnableProfiling {
 		pprof.Register(r)
 	}
-	c.server = &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", c.options.Host, port),
-		Handler: r,
+	if c.options.EnableMetrics {
+		NewMetricsHandler("").Build(r)
 	}
+	server := &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", c.options.Host, port),
+		Handler:           r,
+		ReadHeaderTimeout: seconds(c.options.ReadHeaderTimeout, defaultServerReadHeaderTimeout),
+		ReadTimeout:       seconds(c.options.ReadTimeout, defaultServerReadTimeout),
+		WriteTimeout:      seconds(c.options.WriteTimeout, defaultServerWriteTimeout),
+		IdleTimeout:       seconds(c.options.IdleTimeout, defaultServerIdleTimeout),
+		MaxHeaderBytes:    c.options.MaxHeaderBytes,
+		TLSConfig:         tlsConfig,
+	}
+	if c.options.HTTP2 != nil {
+		h2s := c.buildHTTP2Server(server)
+		if tlsEnabled {
+			if err := http2.ConfigureServer(server, h2s); err != nil {
+				return fmt.Errorf("failed to configure http/2: %w", err)
+			}
+		} else if c.options.HTTP2.H2C {
+			server.Handler = h2c.NewHandler(r, h2s)
+		}
+	}
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", server.Addr, err)
+	}
+	c.server = server
 	go func() {
-		if err := c.server.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if tlsEnabled {
+			err = server.ServeTLS(ln, c.options.PublicCertFile, c.options.PrivateKeyFile)
+		} else {
+			err = server.Serve(ln)
+		}
+		if err != http.ErrServerClosed {
 			c.logger.Error(err, "failed to start Server", "err", err)
 		}
 	}()
 	c.logger.Info("server is listening", "port", port)
+	return nil
+}
+
+func (c *Server) buildHTTP2Server(server *http.Server) *http2.Server {
+	options := c.options.HTTP2
+	idleTimeout := server.IdleTimeout
+	if options.IdleTimeout != 0 {
+		idleTimeout = seconds(options.IdleTimeout, 0)
+	}
+	return &http2.Server{
+		MaxConcurrentStreams:         options.MaxConcurrentStreams,
+		MaxReadFrameSize:             options.MaxReadFrameSize,
+		IdleTimeout:                  idleTimeout,
+		MaxUploadBufferPerConnection: options.MaxUploadBufferPerConnection,
+		MaxUploadBufferPerStream:     options.MaxUploadBufferPerStream,
+	}
+}
+
+// seconds convert option to duration, 0 means the default and negative means no timeout
+func seconds(v int, defaultValue int) time.Duration {
+	if v == 0 {
+		v = defaultValue
+	}
+	if v < 0 {
+		return 0
+	}
+	return time.Duration(v) * time.Second
 }
 
-// Stop stop API Server
+// buildTLSConfig trust client certificates issued by CAFile, they are verified if given and required by mTLS authentication
+func (c *Server) buildTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.options.CAFile == "" {
+		return tlsConfig, nil
+	}
+	content, err := os.ReadFile(filepath.Clean(c.options.CAFile))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no certificate is found in %s", c.options.CAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
+// Stop stop API Server, it is a no-op for the http server if Start or Run failed
 func (c *Server) Stop(ctx context.Context) {
-	c.logger.Info("shutting down Server", "time", time.Now())
-	_, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer func() {
-		cancel()
-	}()
-	if err := c.server.Shutdown(ctx); err != nil {
-		c.logger.Error(err, "failed to shut down Server gracefully")
+	if c.server != nil {
+		c.logger.Info("shutting down Server", "time", time.Now())
+		ctx, cancel := context.WithTimeout(ctx, seconds(c.options.ShutdownTimeout, defaultServerShutdownTimeout))
+		defer cancel()
+		if err := c.server.Shutdown(ctx); err != nil {
+			c.logger.Error(err, "failed to shut down Server gracefully")
+		}
+		c.logger.Info("server is shutdown", "time", time.Now())
+	}
+	for _, h := range c.handlers {
+		if s, ok := h.(Stopper); ok {
+			s.Stop()
+		}
 	}
-	c.logger.Info("server is shutdown", "time", time.Now())
 }
 
 func NewError(gc *gin.Context, status int, err error) {
@@ -91,6 +300,11 @@ type HTTPError struct {
 	Message string `json:"message" example:"status bad request"`
 }
 
+// Error implements error, handlers wrapped by Wrap can return HTTPError directly
+func (e HTTPError) Error() string {
+	return fmt.Sprintf("[%d] %s", e.Code, e.Message)
+}
+
 // StatusResponse status response
 type StatusResponse struct {
 	Message string `json:"message"`
@@ -2,12 +2,16 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"net/http"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/af-go/peach-common/pkg/log"
+	"golang.org/x/net/http2"
 )
 
 const (
@@ -38,13 +42,56 @@ func TestServer(t *testing.T) {
 		t.Fatalf("failed to eval response, expect 'Up', actual: %s", response.Message)
 	}
 	var result string
-	result, err = client.GetRaw("http://localhost:9090/ui", headers)
+	result, err = client.GetRaw(fmt.Sprintf("http://localhost:%d/ui/", port), headers)
 	if err != nil {
 		t.Fatalf("failed execute GET request %v", err)
 	}
-	if strings.Index("result", "Hello World") > 0 {
+	if !strings.Contains(result, "Hello World") {
 		t.Fatalf("failed to eval response, expect 'Hello World', actual: %s", result)
 	}
 	//Server.Stop(ctx)
 
 }
+
+func TestServerH2C(t *testing.T) {
+	serverOptions := ServerOptions{Port: port - 1, HTTP2: &HTTP2Options{H2C: true, MaxConcurrentStreams: 10}}
+	logger := log.NewLogger(false)
+	server := NewServer(serverOptions, logger, NewDummyHealthyHandler())
+	ctx := context.Background()
+	if err := server.Run(ctx); err != nil {
+		t.Fatalf("failed to start server %v", err)
+	}
+	defer server.Stop(ctx)
+
+	client := http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get(fmt.Sprintf("http://localhost:%d/healthz", port-1)); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed execute h2c GET request %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Fatalf("expect 200 over http/2, actual %d %s", resp.StatusCode, resp.Proto)
+	}
+}
+
+func TestServerStartFailure(t *testing.T) {
+	serverOptions := ServerOptions{Port: port - 2, PublicCertFile: "missing.crt", PrivateKeyFile: "missing.key", CAFile: "missing-ca.crt"}
+	server := NewServer(serverOptions, log.NewLogger(false), NewDummyHealthyHandler())
+	ctx := context.Background()
+	if err := server.Run(ctx); err == nil {
+		t.Fatalf("expect error without ca file")
+	}
+	server.Stop(ctx)
+}
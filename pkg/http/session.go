@@ -0,0 +1,383 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	model "github.com/af-go/peach-common/pkg/model/database"
+	"github.com/gin-gonic/gin"
+	"github.com/go-logr/logr"
+)
+
+const (
+	sessionKey = "peach.session"
+
+	defaultSessionCookie = "session"
+	defaultSessionMaxAge = 24 * 60 * 60
+
+	SessionStoreCookie = "cookie"
+	SessionStoreMemory = "memory"
+	SessionStoreMySQL  = "mysql"
+)
+
+// SessionOptions session middleware options
+type SessionOptions struct {
+	// CookieName default session
+	CookieName string `json:"cookieName" yaml:"cookieName"`
+	Domain     string `json:"domain" yaml:"domain"`
+	// Path default /
+	Path string `json:"path" yaml:"path"`
+	// MaxAge seconds a session lives after last change, default one day
+	MaxAge int  `json:"maxAge" yaml:"maxAge"`
+	Secure bool `json:"secure" yaml:"secure"`
+	// SameSite Lax, Strict or None, default Lax
+	SameSite    string `json:"sameSite" yaml:"sameSite"`
+	Partitioned bool   `json:"partitioned" yaml:"partitioned"`
+	// KeysEnvVar environment variable holds comma separated base64 cookie keys, the first key is current
+	KeysEnvVar string `json:"keysEnvVar" yaml:"keysEnvVar"`
+	// Encrypt encrypt cookie with AES-GCM instead of signing it, keys must have 16, 24 or 32 bytes
+	Encrypt bool `json:"encrypt" yaml:"encrypt"`
+	// Store cookie, memory or mysql, default cookie
+	Store string `json:"store" yaml:"store"`
+	// MySQL database of mysql store
+	MySQL *model.MySQLOptions `json:"mysql,omitempty" yaml:"mysql,omitempty"`
+	// Table table of mysql store, default sessions
+	Table string `json:"table" yaml:"table"`
+}
+
+// SessionStore storage of session values.
+// The reference is what the session cookie carries, a session id of server side stores or the values of cookie store.
+type SessionStore interface {
+	// Load load values by reference, nil if not found or expired
+	Load(ctx context.Context, ref string) (map[string]interface{}, error)
+	// Save save values until ttl, ref is empty for a new session, return the reference to carry
+	Save(ctx context.Context, ref string, values map[string]interface{}, ttl time.Duration) (string, error)
+	// Delete delete values by reference
+	Delete(ctx context.Context, ref string) error
+}
+
+// Session values of a client session, values must be json serializable
+type Session struct {
+	mu        sync.Mutex
+	ref       string
+	values    map[string]interface{}
+	modified  bool
+	renewed   bool
+	destroyed bool
+}
+
+// Get get value by key
+func (s *Session) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// GetString get string value by key
+func (s *Session) GetString(key string) string {
+	v, _ := s.Get(key)
+	str, _ := v.(string)
+	return str
+}
+
+// Set set value of key
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+	s.modified = true
+}
+
+// Delete delete value of key
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	s.modified = true
+}
+
+// Renew move values to a new session id, call it after login to prevent session fixation
+func (s *Session) Renew() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.renewed = true
+	s.modified = true
+}
+
+// Destroy delete the session and its cookie
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = make(map[string]interface{})
+	s.destroyed = true
+	s.modified = true
+}
+
+// GetSession get session of request, nil if session middleware is not installed
+func GetSession(gc *gin.Context) *Session {
+	v, ok := gc.Get(sessionKey)
+	if !ok {
+		return nil
+	}
+	s, _ := v.(*Session)
+	return s
+}
+
+// BuildSessionMiddleware create session middleware with codec and store by options
+func BuildSessionMiddleware(options SessionOptions, logger *logr.Logger) (gin.HandlerFunc, error) {
+	if options.KeysEnvVar == "" {
+		return nil, fmt.Errorf("keysEnvVar of session is missing")
+	}
+	keys, err := LoadCookieKeys(options.KeysEnvVar)
+	if err != nil {
+		return nil, err
+	}
+	maxAge := time.Duration(options.MaxAge) * time.Second
+	if options.MaxAge <= 0 {
+		maxAge = defaultSessionMaxAge * time.Second
+	}
+	var codec CookieCodec
+	if options.Encrypt {
+		codec, err = NewEncryptedCookieCodec(maxAge, keys...)
+	} else {
+		codec, err = NewSignedCookieCodec(maxAge, keys...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var store SessionStore
+	switch options.Store {
+	case "", SessionStoreCookie:
+		store = CookieSessionStore{}
+	case SessionStoreMemory:
+		store = NewMemorySessionStore()
+	case SessionStoreMySQL:
+		if options.MySQL == nil {
+			return nil, fmt.Errorf("mysql options of session store are missing")
+		}
+		store, err = NewMySQLSessionStore(*options.MySQL, options.Table)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown session store %s", options.Store)
+	}
+	return NewSessionMiddleware(options, codec, store, logger), nil
+}
+
+// NewSessionMiddleware create middleware which loads session of the session cookie and saves it when modified.
+// The cookie is protected by codec, sessions are saved before the response is written.
+func NewSessionMiddleware(options SessionOptions, codec CookieCodec, store SessionStore, logger *logr.Logger) gin.HandlerFunc {
+	if options.CookieName == "" {
+		options.CookieName = defaultSessionCookie
+	}
+	if options.Path == "" {
+		options.Path = "/"
+	}
+	if options.MaxAge <= 0 {
+		options.MaxAge = defaultSessionMaxAge
+	}
+	if options.SameSite == "" {
+		options.SameSite = SameSiteLax
+	}
+	ttl := time.Duration(options.MaxAge) * time.Second
+	return func(gc *gin.Context) {
+		s := &Session{values: make(map[string]interface{})}
+		if encoded, ok := GetCookie(gc.Request, options.CookieName); ok {
+			if ref, err := codec.Decode(options.CookieName, encoded); err == nil {
+				values, err := store.Load(gc, string(ref))
+				if err != nil {
+					logger.Error(err, "failed to load session")
+				} else if values != nil {
+					s.ref = string(ref)
+					s.values = values
+				}
+			}
+		}
+		gc.Set(sessionKey, s)
+		w := &sessionWriter{ResponseWriter: gc.Writer}
+		w.commit = func() {
+			if err := saveSession(gc, s, options, codec, store, ttl); err != nil {
+				logger.Error(err, "failed to save session")
+			}
+		}
+		gc.Writer = w
+		gc.Next()
+		gc.Writer = w.ResponseWriter
+		w.commitOnce()
+	}
+}
+
+func saveSession(gc *gin.Context, s *Session, options SessionOptions, codec CookieCodec, store SessionStore, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.modified {
+		return nil
+	}
+	cookie := Cookie{Name: options.CookieName, Domain: options.Domain, Path: options.Path, Secure: options.Secure, HttpOnly: true, SameSite: options.SameSite, Partitioned: options.Partitioned}
+	if s.ref != "" && (s.destroyed || s.renewed) {
+		if err := store.Delete(gc, s.ref); err != nil {
+			return err
+		}
+		s.ref = ""
+	}
+	if s.destroyed {
+		cookie.MaxAge = -1
+		cookie.Expires = time.Unix(0, 0)
+		SetCookie(gc.Writer, cookie)
+		return nil
+	}
+	ref, err := store.Save(gc, s.ref, s.values, ttl)
+	if err != nil {
+		return err
+	}
+	encoded, err := codec.Encode(options.CookieName, []byte(ref))
+	if err != nil {
+		return err
+	}
+	s.ref = ref
+	cookie.Value = encoded
+	cookie.MaxAge = options.MaxAge
+	SetCookie(gc.Writer, cookie)
+	return nil
+}
+
+// sessionWriter save session right before headers are written
+type sessionWriter struct {
+	gin.ResponseWriter
+	commit func()
+	once   sync.Once
+}
+
+func (w *sessionWriter) commitOnce() {
+	w.once.Do(w.commit)
+}
+
+func (w *sessionWriter) WriteHeaderNow() {
+	w.commitOnce()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *sessionWriter) Write(data []byte) (int, error) {
+	w.commitOnce()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *sessionWriter) WriteString(s string) (int, error) {
+	w.commitOnce()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *sessionWriter) Flush() {
+	w.commitOnce()
+	w.ResponseWriter.Flush()
+}
+
+// CookieSessionStore store values in the cookie itself, the cookie must stay below 4KB
+type CookieSessionStore struct{}
+
+// Load implements SessionStore
+func (CookieSessionStore) Load(_ context.Context, ref string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(ref), &values); err != nil {
+		return nil, nil
+	}
+	return values, nil
+}
+
+// Save implements SessionStore
+func (CookieSessionStore) Save(_ context.Context, _ string, values map[string]interface{}, _ time.Duration) (string, error) {
+	content, err := json.Marshal(values)
+	return string(content), err
+}
+
+// Delete implements SessionStore
+func (CookieSessionStore) Delete(context.Context, string) error {
+	return nil
+}
+
+// NewMemorySessionStore create in-memory store, sessions only hold within one instance
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: make(map[string]memorySession)}
+}
+
+// MemorySessionStore in-memory session store, expired sessions are removed on write
+type MemorySessionStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memorySession
+	lastSweep time.Time
+}
+
+type memorySession struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// Load implements SessionStore
+func (s *MemorySessionStore) Load(_ context.Context, ref string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	session, ok := s.sessions[ref]
+	s.mu.Unlock()
+	if !ok || !time.Now().Before(session.expiresAt) {
+		return nil, nil
+	}
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(session.data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Save implements SessionStore
+func (s *MemorySessionStore) Save(_ context.Context, ref string, values map[string]interface{}, ttl time.Duration) (string, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		if ref, err = newSessionID(); err != nil {
+			return "", err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	s.sessions[ref] = memorySession{data: data, expiresAt: now.Add(ttl)}
+	return ref, nil
+}
+
+// Delete implements SessionStore
+func (s *MemorySessionStore) Delete(_ context.Context, ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, ref)
+	return nil
+}
+
+func (s *MemorySessionStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for k, session := range s.sessions {
+		if !now.Before(session.expiresAt) {
+			delete(s.sessions, k)
+		}
+	}
+}
+
+// newSessionID random session id of 256 bits
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
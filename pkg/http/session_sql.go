@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	model "github.com/af-go/peach-common/pkg/model/database"
+)
+
+const defaultSessionTable = "sessions"
+
+// NewMySQLSessionStore open mysql/mariadb database and create table of sessions if not exist
+func NewMySQLSessionStore(options model.MySQLOptions, table string) (*SQLSessionStore, error) {
+	db, err := model.Open(options)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSQLSessionStore(db, table)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := s.Migrate(context.Background()); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSQLSessionStore create store on opened database, default table is sessions
+func NewSQLSessionStore(db *sql.DB, table string) (*SQLSessionStore, error) {
+	if table == "" {
+		table = defaultSessionTable
+	}
+	if err := model.ValidateTableName(table); err != nil {
+		return nil, err
+	}
+	return &SQLSessionStore{db: db, table: table}, nil
+}
+
+// SQLSessionStore session store in a sql table
+type SQLSessionStore struct {
+	db    *sql.DB
+	table string
+}
+
+// Migrate create table if not exist
+func (s *SQLSessionStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id CHAR(64) NOT NULL PRIMARY KEY,
+	data MEDIUMBLOB NOT NULL,
+	expires_at BIGINT NOT NULL,
+	INDEX idx_expires_at (expires_at)
+)`, s.table))
+	return err
+}
+
+// Load implements SessionStore
+func (s *SQLSessionStore) Load(ctx context.Context, ref string) (map[string]interface{}, error) {
+	var data []byte
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT data FROM %s WHERE id = ? AND expires_at > ?", s.table), ref, time.Now().UnixMilli())
+	if err := row.Scan(&data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Save implements SessionStore
+func (s *SQLSessionStore) Save(ctx context.Context, ref string, values map[string]interface{}, ttl time.Duration) (string, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		if ref, err = newSessionID(); err != nil {
+			return "", err
+		}
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id, data, expires_at) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE data = VALUES(data), expires_at = VALUES(expires_at)", s.table),
+		ref, data, time.Now().Add(ttl).UnixMilli())
+	if err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+// Delete implements SessionStore
+func (s *SQLSessionStore) Delete(ctx context.Context, ref string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = ?", s.table), ref)
+	return err
+}
+
+// Purge delete expired sessions, call it periodically to keep the table small
+func (s *SQLSessionStore) Purge(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at <= ?", s.table), time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,65 @@
+package http
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/af-go/peach-common/pkg/log"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSessionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	codec, _ := NewSignedCookieCodec(0, bytes.Repeat([]byte{1}, 32))
+	for _, store := range []SessionStore{CookieSessionStore{}, NewMemorySessionStore()} {
+		r := gin.New()
+		r.Use(NewSessionMiddleware(SessionOptions{Secure: true}, codec, store, log.NewLogger(false)))
+		r.POST("/login", func(gc *gin.Context) {
+			s := GetSession(gc)
+			s.Renew()
+			s.Set("user", gc.Query("user"))
+			gc.String(http.StatusOK, "ok")
+		})
+		r.GET("/me", func(gc *gin.Context) {
+			gc.String(http.StatusOK, GetSession(gc).GetString("user"))
+		})
+		r.POST("/logout", func(gc *gin.Context) {
+			GetSession(gc).Destroy()
+			gc.Status(http.StatusNoContent)
+		})
+		do := func(method string, path string, cookie string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, nil)
+			if cookie != "" {
+				req.Header.Set("Cookie", cookie)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		w := do(http.MethodPost, "/login?user=alice", "")
+		c, err := ParseSetCookie(w.Header().Get("Set-Cookie"))
+		if err != nil || c.Name != "session" || !c.HttpOnly || !c.Secure || c.SameSite != SameSiteLax || c.MaxAge <= 0 {
+			t.Fatalf("%T: unexpected session cookie %s", store, w.Header().Get("Set-Cookie"))
+		}
+		cookie := c.Name + "=" + c.Value
+		if w := do(http.MethodGet, "/me", cookie); w.Body.String() != "alice" || w.Header().Get("Set-Cookie") != "" {
+			t.Fatalf("%T: expect session loaded without saving it again, actual %s %v", store, w.Body.String(), w.Header())
+		}
+		if w := do(http.MethodGet, "/me", strings.Replace(cookie, ".", ".x", 1)); w.Body.String() != "" {
+			t.Fatalf("%T: expect tampered cookie ignored, actual %s", store, w.Body.String())
+		}
+		w = do(http.MethodPost, "/logout", cookie)
+		if c, _ := ParseSetCookie(w.Header().Get("Set-Cookie")); c.MaxAge != -1 || c.Value != "" {
+			t.Fatalf("%T: expect session cookie deleted, actual %s", store, w.Header().Get("Set-Cookie"))
+		}
+		if _, ok := store.(*MemorySessionStore); ok {
+			if w := do(http.MethodGet, "/me", cookie); w.Body.String() != "" {
+				t.Fatalf("expect destroyed session removed from store, actual %s", w.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-logr/logr"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	SlowConsumerDisconnect = "disconnect"
+	SlowConsumerDrop       = "drop"
+
+	defaultWebSocketPath       = "/ws"
+	defaultSendBuffer          = 256
+	defaultPingInterval        = 30
+	defaultPongTimeout         = 60
+	defaultWriteTimeout        = 10
+	defaultMaxMessageSize      = 64 * 1024
+	defaultWebSocketBufferSize = 4096
+)
+
+var ErrConnectionClosed = errors.New("websocket connection is closed")
+var ErrSlowConsumer = errors.New("websocket send buffer is full")
+
+// WebSocketOptions websocket handler options
+type WebSocketOptions struct {
+	// Path websocket endpoint, default /ws
+	Path string `json:"path" yaml:"path"`
+	// SendBuffer messages buffered per connection, default 256
+	SendBuffer int `json:"sendBuffer" yaml:"sendBuffer"`
+	// SlowConsumer disconnect or drop, what to do when the send buffer is full, default disconnect
+	SlowConsumer string `json:"slowConsumer" yaml:"slowConsumer"`
+	// PingInterval seconds between pings, default 30
+	PingInterval int `json:"pingInterval" yaml:"pingInterval"`
+	// PongTimeout seconds to wait for pong or any message before closing, default 60
+	PongTimeout int `json:"pongTimeout" yaml:"pongTimeout"`
+	// WriteTimeout seconds to write a message, default 10
+	WriteTimeout int `json:"writeTimeout" yaml:"writeTimeout"`
+	// MaxMessageSize bytes of inbound message, default 64KB
+	MaxMessageSize int64 `json:"maxMessageSize" yaml:"maxMessageSize"`
+	// AllowedOrigins origins accepted besides the same origin, "*" accepts any origin
+	AllowedOrigins []string `json:"allowedOrigins" yaml:"allowedOrigins"`
+	// RequireAuthentication reject anonymous upgrades, the principal is resolved by the server auth middleware
+	RequireAuthentication bool `json:"requireAuthentication" yaml:"requireAuthentication"`
+	// Roles principal must have one of the roles to connect
+	Roles []string `json:"roles" yaml:"roles"`
+}
+
+// WebSocketListener receive websocket connection events, callbacks of one connection are invoked sequentially
+type WebSocketListener interface {
+	OnConnect(conn *WebSocketConn)
+	OnMessage(conn *WebSocketConn, messageType int, data []byte)
+	OnDisconnect(conn *WebSocketConn, err error)
+}
+
+// NewWebSocketHandler create websocket handler, connections are registered in hub
+func NewWebSocketHandler(options WebSocketOptions, hub *Hub, listener WebSocketListener, logger *logr.Logger) *WebSocketHandler {
+	if options.Path == "" {
+		options.Path = defaultWebSocketPath
+	}
+	if options.SendBuffer <= 0 {
+		options.SendBuffer = defaultSendBuffer
+	}
+	if options.SlowConsumer == "" {
+		options.SlowConsumer = SlowConsumerDisconnect
+	}
+	if options.PingInterval <= 0 {
+		options.PingInterval = defaultPingInterval
+	}
+	if options.PongTimeout <= 0 {
+		options.PongTimeout = defaultPongTimeout
+	}
+	if options.WriteTimeout <= 0 {
+		options.WriteTimeout = defaultWriteTimeout
+	}
+	if options.MaxMessageSize <= 0 {
+		options.MaxMessageSize = defaultMaxMessageSize
+	}
+	h := WebSocketHandler{options: options, hub: hub, listener: listener, logger: logger}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  defaultWebSocketBufferSize,
+		WriteBufferSize: defaultWebSocketBufferSize,
+		CheckOrigin:     h.checkOrigin,
+	}
+	return &h
+}
+
+// WebSocketHandler upgrade requests to websocket connections
+type WebSocketHandler struct {
+	options  WebSocketOptions
+	hub      *Hub
+	listener WebSocketListener
+	logger   *logr.Logger
+	upgrader websocket.Upgrader
+}
+
+// Build build websocket handler
+func (h *WebSocketHandler) Build(engine *gin.Engine) {
+	handlers := []gin.HandlerFunc{}
+	if len(h.options.Roles) > 0 {
+		handlers = append(handlers, RequireRoles(h.options.Roles...))
+	} else if h.options.RequireAuthentication {
+		handlers = append(handlers, RequireAuthentication())
+	}
+	handlers = append(handlers, h.serve)
+	engine.GET(h.options.Path, handlers...)
+}
+
+func (h *WebSocketHandler) serve(gc *gin.Context) {
+	ws, err := h.upgrader.Upgrade(gc.Writer, gc.Request, nil)
+	if err != nil {
+		// upgrader has written the error response
+		h.logger.Error(err, "failed to upgrade websocket connection", "client", gc.ClientIP())
+		return
+	}
+	principal, _ := GetPrincipal(gc)
+	conn := &WebSocketConn{
+		ID:        nextConnID(),
+		Principal: principal,
+		ws:        ws,
+		send:      make(chan outboundMessage, h.options.SendBuffer),
+		done:      make(chan struct{}),
+		hub:       h.hub,
+		options:   h.options,
+		logger:    h.logger,
+	}
+	h.hub.register(conn)
+	h.logger.V(1).Info("websocket connected", "conn", conn.ID, "client", gc.ClientIP())
+	if h.listener != nil {
+		h.listener.OnConnect(conn)
+	}
+	go conn.writePump()
+	err = conn.readPump(h.listener)
+	conn.close(err)
+	h.hub.unregister(conn)
+	if h.listener != nil {
+		h.listener.OnDisconnect(conn, err)
+	}
+	h.logger.V(1).Info("websocket disconnected", "conn", conn.ID)
+}
+
+func (h *WebSocketHandler) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range h.options.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+var connSequence int64
+
+func nextConnID() int64 {
+	return atomic.AddInt64(&connSequence, 1)
+}
+
+type outboundMessage struct {
+	messageType int
+	data        []byte
+}
+
+// WebSocketConn server side websocket connection
+type WebSocketConn struct {
+	ID        int64
+	Principal *Principal
+	ws        *websocket.Conn
+	send      chan outboundMessage
+	done      chan struct{}
+	closeOnce sync.Once
+	hub       *Hub
+	options   WebSocketOptions
+	logger    *logr.Logger
+	dropped   int64
+}
+
+// Send queue text message, it never blocks, see WebSocketOptions.SlowConsumer
+func (c *WebSocketConn) Send(data []byte) error {
+	return c.SendMessage(websocket.TextMessage, data)
+}
+
+// SendMessage queue message of type websocket.TextMessage or websocket.BinaryMessage
+func (c *WebSocketConn) SendMessage(messageType int, data []byte) error {
+	select {
+	case <-c.done:
+		return ErrConnectionClosed
+	default:
+	}
+	select {
+	case c.send <- outboundMessage{messageType: messageType, data: data}:
+		return nil
+	case <-c.done:
+		return ErrConnectionClosed
+	default:
+	}
+	if c.options.SlowConsumer == SlowConsumerDrop {
+		atomic.AddInt64(&c.dropped, 1)
+		return ErrSlowConsumer
+	}
+	c.logger.Info("disconnect slow websocket consumer", "conn", c.ID, "buffer", cap(c.send))
+	c.close(ErrSlowConsumer)
+	return ErrSlowConsumer
+}
+
+// Dropped number of messages dropped for slow consumer
+func (c *WebSocketConn) Dropped() int64 {
+	return atomic.LoadInt64(&c.dropped)
+}
+
+// Join subscribe the connection to a room or topic
+func (c *WebSocketConn) Join(room string) {
+	c.hub.Join(c, room)
+}
+
+// Leave unsubscribe the connection from a room or topic
+func (c *WebSocketConn) Leave(room string) {
+	c.hub.Leave(c, room)
+}
+
+// Close close the connection
+func (c *WebSocketConn) Close() {
+	c.close(nil)
+}
+
+func (c *WebSocketConn) close(reason error) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		code := websocket.CloseNormalClosure
+		if errors.Is(reason, ErrSlowConsumer) {
+			code = websocket.ClosePolicyViolation
+		}
+		deadline := time.Now().Add(time.Duration(c.options.WriteTimeout) * time.Second)
+		_ = c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), deadline)
+		_ = c.ws.Close()
+	})
+}
+
+func (c *WebSocketConn) readPump(listener WebSocketListener) error {
+	pongTimeout := time.Duration(c.options.PongTimeout) * time.Second
+	c.ws.SetReadLimit(c.options.MaxMessageSize)
+	_ = c.ws.SetReadDeadline(time.Now().Add(pongTimeout))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+	for {
+		messageType, data, err := c.ws.ReadMessage()
+		if err != nil {
+			select {
+			case <-c.done:
+				return nil
+			default:
+			}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return err
+		}
+		_ = c.ws.SetReadDeadline(time.Now().Add(pongTimeout))
+		if listener != nil {
+			listener.OnMessage(c, messageType, data)
+		}
+	}
+}
+
+func (c *WebSocketConn) writePump() {
+	ticker := time.NewTicker(time.Duration(c.options.PingInterval) * time.Second)
+	defer ticker.Stop()
+	writeTimeout := time.Duration(c.options.WriteTimeout) * time.Second
+	for {
+		select {
+		case m := <-c.send:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.ws.WriteMessage(m.messageType, m.data); err != nil {
+				c.close(err)
+				return
+			}
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				c.close(err)
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// NewHub create connection hub
+func NewHub() *Hub {
+	return &Hub{conns: make(map[int64]*WebSocketConn), rooms: make(map[string]map[int64]*WebSocketConn)}
+}
+
+// Hub track connections and their rooms, rooms are used as topics for publishing
+type Hub struct {
+	mu    sync.RWMutex
+	conns map[int64]*WebSocketConn
+	rooms map[string]map[int64]*WebSocketConn
+}
+
+func (h *Hub) register(c *WebSocketConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.conns[c.ID] = c
+}
+
+func (h *Hub) unregister(c *WebSocketConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, c.ID)
+	for name, room := range h.rooms {
+		delete(room, c.ID)
+		if len(room) == 0 {
+			delete(h.rooms, name)
+		}
+	}
+}
+
+// Join subscribe connection to room
+func (h *Hub) Join(c *WebSocketConn, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.conns[c.ID]; !ok {
+		return
+	}
+	members, ok := h.rooms[room]
+	if !ok {
+		members = make(map[int64]*WebSocketConn)
+		h.rooms[room] = members
+	}
+	members[c.ID] = c
+}
+
+// Leave unsubscribe connection from room
+func (h *Hub) Leave(c *WebSocketConn, room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if members, ok := h.rooms[room]; ok {
+		delete(members, c.ID)
+		if len(members) == 0 {
+			delete(h.rooms, room)
+		}
+	}
+}
+
+// Broadcast send text message to every connection, return number of connections it was queued for
+func (h *Hub) Broadcast(data []byte) int {
+	h.mu.RLock()
+	targets := make([]*WebSocketConn, 0, len(h.conns))
+	for _, c := range h.conns {
+		targets = append(targets, c)
+	}
+	h.mu.RUnlock()
+	return deliver(targets, data)
+}
+
+// Publish send text message to members of room
+func (h *Hub) Publish(room string, data []byte) int {
+	h.mu.RLock()
+	targets := make([]*WebSocketConn, 0, len(h.rooms[room]))
+	for _, c := range h.rooms[room] {
+		targets = append(targets, c)
+	}
+	h.mu.RUnlock()
+	return deliver(targets, data)
+}
+
+// Count number of connections
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.conns)
+}
+
+// Rooms room names and their member counts
+func (h *Hub) Rooms() map[string]int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	rooms := make(map[string]int)
+	for name, members := range h.rooms {
+		rooms[name] = len(members)
+	}
+	return rooms
+}
+
+// deliver send outside of the hub lock, a slow consumer may be unregistered meanwhile
+func deliver(targets []*WebSocketConn, data []byte) int {
+	n := 0
+	for _, c := range targets {
+		if c.Send(data) == nil {
+			n++
+		}
+	}
+	return n
+}
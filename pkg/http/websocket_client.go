@@ -0,0 +1,194 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrSendBufferFull = errors.New("websocket client send buffer is full")
+
+// WebSocketClientOptions reconnecting websocket client options
+type WebSocketClientOptions struct {
+	// MinBackoff seconds before the first reconnect attempt, doubled on every failure, default 1
+	MinBackoff int `json:"minBackoff" yaml:"minBackoff"`
+	// MaxBackoff seconds between reconnect attempts, default 30
+	MaxBackoff int `json:"maxBackoff" yaml:"maxBackoff"`
+	// SendBuffer messages buffered while disconnected, default 256
+	SendBuffer int `json:"sendBuffer" yaml:"sendBuffer"`
+	// WriteTimeout seconds to write a message, default 10
+	WriteTimeout int `json:"writeTimeout" yaml:"writeTimeout"`
+	// OnConnect optional callback after every successful (re)connect, e.g. to join rooms again
+	OnConnect func() `json:"-" yaml:"-"`
+}
+
+// WebSocketMessageFunc handle inbound message of websocket client
+type WebSocketMessageFunc func(messageType int, data []byte)
+
+// DialWebSocket connect to websocket endpoint in background, reconnect with backoff until Close is called
+func (c *Client) DialWebSocket(target string, headers map[string]string, options WebSocketClientOptions, onMessage WebSocketMessageFunc) *WebSocketClient {
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = 1
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = 30
+	}
+	if options.SendBuffer <= 0 {
+		options.SendBuffer = defaultSendBuffer
+	}
+	if options.WriteTimeout <= 0 {
+		options.WriteTimeout = defaultWriteTimeout
+	}
+	header := http.Header{}
+	for k, v := range headers {
+		header.Set(k, v)
+	}
+	dialer := *websocket.DefaultDialer
+	if c.options.Timeout > 0 {
+		dialer.HandshakeTimeout = time.Duration(c.options.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := WebSocketClient{
+		target:    target,
+		header:    header,
+		dialer:    &dialer,
+		options:   options,
+		onMessage: onMessage,
+		send:      make(chan outboundMessage, options.SendBuffer),
+		ctx:       ctx,
+		cancel:    cancel,
+		client:    c,
+	}
+	w.wg.Add(1)
+	go w.run()
+	return &w
+}
+
+// WebSocketClient websocket client which reconnects automatically.
+// Messages queued with Send are delivered at most once, a message being written when the connection drops is lost.
+type WebSocketClient struct {
+	target    string
+	header    http.Header
+	dialer    *websocket.Dialer
+	options   WebSocketClientOptions
+	onMessage WebSocketMessageFunc
+	send      chan outboundMessage
+	ctx       context.Context
+	cancel    context.CancelFunc
+	client    *Client
+	wg        sync.WaitGroup
+	mu        sync.RWMutex
+	conn      *websocket.Conn
+}
+
+// Send queue text message, it is delivered once connected
+func (w *WebSocketClient) Send(data []byte) error {
+	return w.SendMessage(websocket.TextMessage, data)
+}
+
+// SendMessage queue message of type websocket.TextMessage or websocket.BinaryMessage
+func (w *WebSocketClient) SendMessage(messageType int, data []byte) error {
+	select {
+	case <-w.ctx.Done():
+		return ErrConnectionClosed
+	case w.send <- outboundMessage{messageType: messageType, data: data}:
+		return nil
+	default:
+		return ErrSendBufferFull
+	}
+}
+
+// Connected whether the client is connected now
+func (w *WebSocketClient) Connected() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.conn != nil
+}
+
+// Close stop reconnecting and close the connection
+func (w *WebSocketClient) Close() {
+	w.cancel()
+	w.mu.RLock()
+	if w.conn != nil {
+		_ = w.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		_ = w.conn.Close()
+	}
+	w.mu.RUnlock()
+	w.wg.Wait()
+}
+
+func (w *WebSocketClient) run() {
+	defer w.wg.Done()
+	backoff := time.Duration(w.options.MinBackoff) * time.Second
+	for {
+		conn, _, err := w.dialer.DialContext(w.ctx, w.target, w.header)
+		if err == nil {
+			backoff = time.Duration(w.options.MinBackoff) * time.Second
+			w.serve(conn)
+		} else {
+			w.client.logger.Error(err, "failed to connect websocket", "target", w.target, "retry", backoff.String())
+		}
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if err != nil {
+			backoff *= 2
+			if limit := time.Duration(w.options.MaxBackoff) * time.Second; backoff > limit {
+				backoff = limit
+			}
+		}
+	}
+}
+
+// serve pump messages until the connection drops or the client is closed
+func (w *WebSocketClient) serve(conn *websocket.Conn) {
+	w.mu.Lock()
+	w.conn = conn
+	w.mu.Unlock()
+	w.client.logger.V(1).Info("websocket connected", "target", w.target)
+	if w.options.OnConnect != nil {
+		w.options.OnConnect()
+	}
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				if w.ctx.Err() == nil && !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+					w.client.logger.Error(err, "websocket connection is lost", "target", w.target)
+				}
+				return
+			}
+			if w.onMessage != nil {
+				w.onMessage(messageType, data)
+			}
+		}
+	}()
+	writeTimeout := time.Duration(w.options.WriteTimeout) * time.Second
+	for done := false; !done; {
+		select {
+		case m := <-w.send:
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteMessage(m.messageType, m.data); err != nil {
+				w.client.logger.Error(err, "failed to write websocket message", "target", w.target)
+				done = true
+			}
+		case <-readDone:
+			done = true
+		case <-w.ctx.Done():
+			done = true
+		}
+	}
+	w.mu.Lock()
+	w.conn = nil
+	w.mu.Unlock()
+	_ = conn.Close()
+	<-readDone
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/af-go/peach-common/pkg/log"
+	"github.com/gin-gonic/gin"
+)
+
+// roomListener join the room named by the first message, then echo messages to the room
+type roomListener struct{}
+
+func (l *roomListener) OnConnect(conn *WebSocketConn) {}
+
+func (l *roomListener) OnMessage(conn *WebSocketConn, messageType int, data []byte) {
+	if room, ok := strings.CutPrefix(string(data), "join:"); ok {
+		conn.Join(room)
+		_ = conn.Send([]byte("joined:" + room))
+		return
+	}
+	conn.hub.Publish("dashboard", data)
+}
+
+func (l *roomListener) OnDisconnect(conn *WebSocketConn, err error) {}
+
+func TestWebSocket(t *testing.T) {
+	logger := log.NewLogger(true)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	hub := NewHub()
+	NewWebSocketHandler(WebSocketOptions{}, hub, &roomListener{}, logger).Build(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	received := make(chan string, 10)
+	client := NewClient(ClientOptions{Timeout: 5}, logger)
+	ws := client.DialWebSocket("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil, WebSocketClientOptions{}, func(messageType int, data []byte) {
+		received <- string(data)
+	})
+	defer ws.Close()
+
+	expect := func(message string) {
+		select {
+		case m := <-received:
+			if m != message {
+				t.Fatalf("expect %q, actual %q", message, m)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %q", message)
+		}
+	}
+	if err := ws.Send([]byte("join:dashboard")); err != nil {
+		t.Fatalf("failed to send %v", err)
+	}
+	expect("joined:dashboard")
+	if hub.Count() != 1 || hub.Rooms()["dashboard"] != 1 {
+		t.Fatalf("unexpected hub state %d %v", hub.Count(), hub.Rooms())
+	}
+	_ = ws.Send([]byte("cpu=42"))
+	expect("cpu=42")
+	if n := hub.Broadcast([]byte("maintenance")); n != 1 {
+		t.Fatalf("expect broadcast to 1 connection, actual %d", n)
+	}
+	expect("maintenance")
+}
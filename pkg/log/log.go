@@ -24,6 +24,12 @@ func NewLogger(enableDebug bool) *logr.Logger {
 }*/
 
 func NewLogger(enableDebug bool) *logr.Logger {
+	logger, _ := NewLoggerWithLevel(enableDebug)
+	return logger
+}
+
+// NewLoggerWithLevel create logger and return its level, which can be changed at runtime, e.g. by the admin handler
+func NewLoggerWithLevel(enableDebug bool) (*logr.Logger, zap.AtomicLevel) {
 	var zc zap.Config
 	if enableDebug {
 		zc = zap.NewDevelopmentConfig()
@@ -35,5 +41,5 @@ func NewLogger(enableDebug bool) *logr.Logger {
 		panic(fmt.Sprintf("failed to build logger (%v)?", err))
 	}
 	logger := zapr.NewLogger(z)
-	return &logger
+	return &logger, zc.Level
 }
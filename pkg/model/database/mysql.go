@@ -1,5 +1,16 @@
 package database
 
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 type MySQLOptions struct {
 	Host     string `json:"host" yaml:"host"`
 	Port     int    `json:"port" yaml:"port"`
@@ -7,3 +18,24 @@ type MySQLOptions struct {
 	Password string `json:"password" yaml:"password"`
 	Database string `json:"database" yaml:"database"`
 }
+
+// Open open mysql/mariadb database with the shared connection pool settings, connections are made lazily
+func Open(options MySQLOptions) (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s:%s@(%s:%d)/%s", options.Username, options.Password, options.Host, options.Port, options.Database)
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetConnMaxLifetime(time.Minute * 3)
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(10)
+	return db, nil
+}
+
+// ValidateTableName check table name is a plain identifier, table names can't be bound as query parameters
+func ValidateTableName(table string) error {
+	if !tableNamePattern.MatchString(table) {
+		return fmt.Errorf("invalid table name %s", table)
+	}
+	return nil
+}
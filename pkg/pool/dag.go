@@ -0,0 +1,380 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DAGFailFast running nodes are cancelled and no node is started once a node fails
+	DAGFailFast = "fail-fast"
+	// DAGContinue nodes not depending on a failed node keep running
+	DAGContinue = "continue"
+)
+
+var ErrDependencyFailed = errors.New("dependency of task failed")
+
+// DAGTask task of a DAG node, inputs are the results of its dependencies by node name
+type DAGTask interface {
+	GetName() string
+	RunDAG(ctx context.Context, inputs map[string]interface{}) (interface{}, error)
+}
+
+// NewDAGTask create DAGTask running fn
+func NewDAGTask(name string, fn func(ctx context.Context, inputs map[string]interface{}) (interface{}, error)) DAGTask {
+	return &dagFunc{name: name, fn: fn}
+}
+
+type dagFunc struct {
+	name string
+	fn   func(ctx context.Context, inputs map[string]interface{}) (interface{}, error)
+}
+
+func (d *dagFunc) GetName() string {
+	return d.name
+}
+
+func (d *dagFunc) RunDAG(ctx context.Context, inputs map[string]interface{}) (interface{}, error) {
+	return d.fn(ctx, inputs)
+}
+
+// DAGNode node of DAG, it runs once all DependsOn nodes succeed
+type DAGNode struct {
+	Name      string
+	Task      DAGTask
+	DependsOn []string
+	Dispatch  DispatchOptions
+}
+
+// DAG tasks with dependencies
+type DAG struct {
+	Nodes []DAGNode
+	// Policy fail-fast or continue, default fail-fast
+	Policy string
+}
+
+// DAGReport status of DAG and its nodes
+type DAGReport struct {
+	// State running until all nodes are done, then succeeded if all nodes succeeded, failed or cancelled otherwise
+	State     TaskState
+	Nodes     map[string]TaskStatus
+	StartTime time.Time
+	Duration  time.Duration
+}
+
+// DAGRun running DAG
+type DAGRun struct {
+	pool    *Pool
+	dag     DAG
+	nodes   map[string]*DAGNode
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	report  DAGReport
+	futures map[string]*Future
+	done    chan struct{}
+}
+
+// dagNodeTask run task of node with inputs of upstream nodes
+type dagNodeTask struct {
+	task   DAGTask
+	inputs map[string]interface{}
+}
+
+func (t *dagNodeTask) GetName() string {
+	return t.task.GetName()
+}
+
+func (t *dagNodeTask) RunContext(ctx context.Context, workRoutine int) (interface{}, error) {
+	return t.task.RunDAG(ctx, t.inputs)
+}
+
+// SubmitDAG validate DAG and run its nodes in pool, cycles and unknown dependencies are rejected
+func (p *Pool) SubmitDAG(dag DAG) (*DAGRun, error) {
+	if dag.Policy == "" {
+		dag.Policy = DAGFailFast
+	}
+	nodes, err := validateDAG(dag)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &DAGRun{
+		pool: p, dag: dag, nodes: nodes, ctx: ctx, cancel: cancel,
+		report:  DAGReport{State: TaskRunning, Nodes: map[string]TaskStatus{}, StartTime: time.Now()},
+		futures: map[string]*Future{},
+		done:    make(chan struct{}),
+	}
+	for name := range nodes {
+		r.report.Nodes[name] = TaskStatus{Name: name, State: TaskQueued}
+	}
+	go r.run()
+	return r, nil
+}
+
+// validateDAG check names and dependencies of nodes, cycles are reported with the nodes on them
+func validateDAG(dag DAG) (map[string]*DAGNode, error) {
+	nodes := map[string]*DAGNode{}
+	for i := range dag.Nodes {
+		n := &dag.Nodes[i]
+		if n.Name == "" || n.Task == nil {
+			return nil, fmt.Errorf("dag node %d requires name and task", i)
+		}
+		if _, ok := nodes[n.Name]; ok {
+			return nil, fmt.Errorf("duplicated dag node %s", n.Name)
+		}
+		nodes[n.Name] = n
+	}
+	indegree := map[string]int{}
+	for name, n := range nodes {
+		for _, d := range n.DependsOn {
+			if _, ok := nodes[d]; !ok {
+				return nil, fmt.Errorf("dag node %s depends on unknown node %s", name, d)
+			}
+		}
+		indegree[name] = len(n.DependsOn)
+	}
+	ready := []string{}
+	for name, d := range indegree {
+		if d == 0 {
+			ready = append(ready, name)
+		}
+	}
+	visited := 0
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		visited++
+		for _, n := range nodes {
+			for _, d := range n.DependsOn {
+				if d == name {
+					indegree[n.Name]--
+					if indegree[n.Name] == 0 {
+						ready = append(ready, n.Name)
+					}
+				}
+			}
+		}
+	}
+	if visited != len(nodes) {
+		cycle := []string{}
+		for name, d := range indegree {
+			if d > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("dag has cycle through nodes %s", strings.Join(cycle, ", "))
+	}
+	return nodes, nil
+}
+
+// run dispatch nodes whose dependencies succeeded until all nodes are done
+func (r *DAGRun) run() {
+	completed := make(chan string, len(r.nodes))
+	pending := len(r.nodes)
+	failed := false
+	// nodes failed to submit fail the DAG like nodes failed to run
+	dispatch := func() {
+		finished, submitFailed := r.dispatchReady(completed)
+		pending -= finished
+		if submitFailed {
+			failed = true
+			if r.dag.Policy == DAGFailFast {
+				pending -= r.abort()
+			}
+		}
+	}
+	dispatch()
+	for pending > 0 {
+		select {
+		case name := <-completed:
+			pending--
+			status := r.futures[name].TaskStatus()
+			r.setStatus(name, status)
+			if status.State != TaskSucceeded {
+				failed = true
+				pending -= r.skipDependents(name)
+				if r.dag.Policy == DAGFailFast {
+					pending -= r.abort()
+				}
+			}
+			if !failed || r.dag.Policy == DAGContinue {
+				dispatch()
+			}
+		case <-r.ctx.Done():
+			pending -= r.abort()
+			// wait for running nodes to stop
+			for pending > 0 {
+				name := <-completed
+				pending--
+				r.setStatus(name, r.futures[name].TaskStatus())
+			}
+		}
+	}
+	r.mu.Lock()
+	r.report.State = TaskSucceeded
+	for _, s := range r.report.Nodes {
+		if s.State == TaskFailed {
+			r.report.State = TaskFailed
+			break
+		}
+		if s.State == TaskCancelled {
+			r.report.State = TaskCancelled
+		}
+	}
+	r.report.Duration = time.Since(r.report.StartTime)
+	r.mu.Unlock()
+	r.cancel()
+	close(r.done)
+}
+
+// dispatchReady submit queued nodes whose dependencies succeeded, nodes stay queued until the pool starts them.
+// Number of nodes failed to submit or skipped by them is returned, and whether any node failed to submit
+func (r *DAGRun) dispatchReady(completed chan<- string) (int, bool) {
+	failed := 0
+	submitFailed := false
+	names := make([]string, 0, len(r.nodes))
+	for name := range r.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !r.ready(name) {
+			continue
+		}
+		n := r.nodes[name]
+		inputs := map[string]interface{}{}
+		r.mu.Lock()
+		for _, d := range n.DependsOn {
+			inputs[d] = r.report.Nodes[d].Data
+		}
+		r.mu.Unlock()
+		f, err := r.pool.SubmitContext(&dagNodeTask{task: n.Task, inputs: inputs}, n.Dispatch)
+		if err != nil {
+			r.setStatus(name, TaskStatus{Name: name, State: TaskFailed, Err: err})
+			submitFailed = true
+			failed++
+			failed += r.skipDependents(name)
+			continue
+		}
+		r.mu.Lock()
+		r.futures[name] = f
+		r.report.Nodes[name] = TaskStatus{ID: f.ID(), Name: name, State: TaskQueued}
+		r.mu.Unlock()
+		go func(name string, f *Future) {
+			<-f.Done()
+			completed <- name
+		}(name, f)
+	}
+	return failed, submitFailed
+}
+
+// ready whether node is queued, not submitted yet and all of its dependencies succeeded
+func (r *DAGRun) ready(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, submitted := r.futures[name]; submitted || r.report.Nodes[name].State != TaskQueued {
+		return false
+	}
+	for _, d := range r.nodes[name].DependsOn {
+		if r.report.Nodes[d].State != TaskSucceeded {
+			return false
+		}
+	}
+	return true
+}
+
+// skipDependents cancel queued nodes depending on node directly or indirectly, number of cancelled nodes is returned
+func (r *DAGRun) skipDependents(name string) int {
+	skipped := 0
+	for _, n := range r.nodes {
+		for _, d := range n.DependsOn {
+			if d != name {
+				continue
+			}
+			r.mu.Lock()
+			_, submitted := r.futures[n.Name]
+			queued := !submitted && r.report.Nodes[n.Name].State == TaskQueued
+			if queued {
+				r.report.Nodes[n.Name] = TaskStatus{Name: n.Name, State: TaskCancelled, Err: ErrDependencyFailed}
+			}
+			r.mu.Unlock()
+			if queued {
+				skipped++
+				skipped += r.skipDependents(n.Name)
+			}
+		}
+	}
+	return skipped
+}
+
+// abort cancel all queued nodes and dispatched tasks, number of cancelled nodes not submitted yet is returned
+func (r *DAGRun) abort() int {
+	r.cancel()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.futures {
+		r.pool.Cancel(f.ID())
+	}
+	cancelled := 0
+	for name, s := range r.report.Nodes {
+		if _, submitted := r.futures[name]; !submitted && s.State == TaskQueued {
+			r.report.Nodes[name] = TaskStatus{Name: name, State: TaskCancelled, Err: ErrDependencyFailed}
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+func (r *DAGRun) setStatus(name string, status TaskStatus) {
+	status.Name = name
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Nodes[name] = status
+}
+
+// Cancel cancel queued and running nodes
+func (r *DAGRun) Cancel() {
+	r.cancel()
+}
+
+// Done closed when all nodes are done
+func (r *DAGRun) Done() <-chan struct{} {
+	return r.done
+}
+
+// Wait wait until all nodes are done or ctx is done, the report is returned in either case
+func (r *DAGRun) Wait(ctx context.Context) (DAGReport, error) {
+	select {
+	case <-r.done:
+		return r.Report(), nil
+	case <-ctx.Done():
+		return r.Report(), ctx.Err()
+	}
+}
+
+// Report current status of DAG and its nodes
+func (r *DAGRun) Report() DAGReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := r.report
+	report.Nodes = make(map[string]TaskStatus, len(r.report.Nodes))
+	for name, s := range r.report.Nodes {
+		// submitted nodes are running once the pool starts them
+		if f, ok := r.futures[name]; ok && s.State == TaskQueued {
+			s = f.TaskStatus()
+			s.Name = name
+		}
+		report.Nodes[name] = s
+	}
+	if report.State == TaskRunning {
+		report.Duration = time.Since(report.StartTime)
+	}
+	return report
+}
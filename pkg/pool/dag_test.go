@@ -0,0 +1,132 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/af-go/peach-common/pkg/log"
+)
+
+func concatTask(name string, fail bool) DAGTask {
+	return NewDAGTask(name, func(ctx context.Context, inputs map[string]interface{}) (interface{}, error) {
+		if fail {
+			return nil, errors.New("failed")
+		}
+		parts := []string{}
+		for _, v := range inputs {
+			parts = append(parts, v.(string))
+		}
+		return fmt.Sprintf("%s(%d)", name, len(parts)), nil
+	})
+}
+
+func TestDAG(t *testing.T) {
+	logger := log.NewLogger(false)
+	pool := NewWithOptions(Options{Name: "dag", MinRoutines: 2, MaxRoutines: 2}, logger)
+	defer pool.Shutdown()
+	_, err := pool.SubmitDAG(DAG{Nodes: []DAGNode{
+		{Name: "a", Task: concatTask("a", false), DependsOn: []string{"c"}},
+		{Name: "b", Task: concatTask("b", false), DependsOn: []string{"a"}},
+		{Name: "c", Task: concatTask("c", false), DependsOn: []string{"b"}},
+		{Name: "d", Task: concatTask("d", false)},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "a, b, c") {
+		t.Fatalf("expect cycle detected, actual %v", err)
+	}
+	if _, err := pool.SubmitDAG(DAG{Nodes: []DAGNode{{Name: "a", Task: concatTask("a", false), DependsOn: []string{"x"}}}}); err == nil {
+		t.Fatalf("expect unknown dependency rejected")
+	}
+
+	run, err := pool.SubmitDAG(DAG{Nodes: []DAGNode{
+		{Name: "build", Task: concatTask("build", false)},
+		{Name: "test", Task: concatTask("test", false), DependsOn: []string{"build"}},
+		{Name: "lint", Task: concatTask("lint", false), DependsOn: []string{"build"}},
+		{Name: "release", Task: NewDAGTask("release", func(ctx context.Context, inputs map[string]interface{}) (interface{}, error) {
+			return fmt.Sprintf("%v+%v", inputs["test"], inputs["lint"]), nil
+		}), DependsOn: []string{"test", "lint"}},
+	}})
+	if err != nil {
+		t.Fatalf("failed to submit dag %v", err)
+	}
+	report, _ := run.Wait(context.Background())
+	if report.State != TaskSucceeded || report.Nodes["release"].Data != "test(1)+lint(1)" {
+		t.Fatalf("expect upstream results passed to release, actual %+v", report)
+	}
+
+	for _, policy := range []string{DAGFailFast, DAGContinue} {
+		run, _ := pool.SubmitDAG(DAG{Policy: policy, Nodes: []DAGNode{
+			{Name: "a", Task: concatTask("a", true)},
+			{Name: "b", Task: concatTask("b", false), DependsOn: []string{"a"}},
+			{Name: "c", Task: concatTask("c", false), DependsOn: []string{"b"}},
+			{Name: "x", Task: concatTask("x", false), DependsOn: []string{"y"}},
+			{Name: "y", Task: NewDAGTask("y", func(ctx context.Context, inputs map[string]interface{}) (interface{}, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			})},
+		}})
+		if policy == DAGContinue {
+			// independent branch keeps running until the dag is cancelled
+			for run.Report().Nodes["a"].State != TaskFailed {
+				time.Sleep(time.Millisecond)
+			}
+			run.Cancel()
+		}
+		report, _ := run.Wait(context.Background())
+		if report.State != TaskFailed || report.Nodes["a"].State != TaskFailed {
+			t.Fatalf("expect dag failed with %s, actual %+v", policy, report)
+		}
+		for _, name := range []string{"b", "c", "x"} {
+			if s := report.Nodes[name]; s.State != TaskCancelled || s.Err != ErrDependencyFailed {
+				t.Fatalf("expect node %s cancelled with %s, actual %+v", name, policy, s)
+			}
+		}
+		if report.Nodes["y"].State != TaskCancelled {
+			t.Fatalf("expect running node cancelled with %s, actual %+v", policy, report.Nodes["y"])
+		}
+	}
+}
+
+func TestDAGQueuedNodes(t *testing.T) {
+	logger := log.NewLogger(false)
+	pool := NewWithOptions(Options{Name: "dag-queued", MinRoutines: 1, MaxRoutines: 1, QueueCapacity: 1, Overflow: OverflowReject}, logger)
+	defer pool.Shutdown()
+	release := make(chan struct{})
+	busy, _ := pool.Submit(&emailTask{To: "busy", release: release, sent: &sync.Map{}})
+	for busy.Status() != TaskRunning {
+		time.Sleep(time.Millisecond)
+	}
+
+	run, _ := pool.SubmitDAG(DAG{Nodes: []DAGNode{{Name: "a", Task: concatTask("a", false)}}})
+	time.Sleep(20 * time.Millisecond)
+	if s := run.Report().Nodes["a"]; s.State != TaskQueued || s.ID == "" {
+		t.Fatalf("expect node queued until the pool starts it, actual %+v", s)
+	}
+	close(release)
+	if report, _ := run.Wait(context.Background()); report.State != TaskSucceeded {
+		t.Fatalf("expect dag succeeded, actual %+v", report)
+	}
+
+	release = make(chan struct{})
+	busy, _ = pool.Submit(&emailTask{To: "busy", release: release, sent: &sync.Map{}})
+	for busy.Status() != TaskRunning {
+		time.Sleep(time.Millisecond)
+	}
+	run, _ = pool.SubmitDAG(DAG{Nodes: []DAGNode{
+		{Name: "a", Task: concatTask("a", false)},
+		{Name: "b", Task: concatTask("b", false)},
+		{Name: "c", Task: concatTask("c", false), DependsOn: []string{"a"}},
+	}})
+	report, _ := run.Wait(context.Background())
+	close(release)
+	if report.State != TaskFailed || !errors.Is(report.Nodes["b"].Err, ErrQueueFull) {
+		t.Fatalf("expect dag failed by node rejected from full queue, actual %+v", report)
+	}
+	if report.Nodes["a"].State != TaskCancelled || report.Nodes["c"].State != TaskCancelled {
+		t.Fatalf("expect fail-fast cancels submitted and queued nodes, actual %+v", report)
+	}
+}
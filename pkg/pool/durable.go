@@ -0,0 +1,237 @@
+package pool
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	model "github.com/af-go/peach-common/pkg/model/database"
+	"github.com/go-logr/logr"
+)
+
+const (
+	DurableStoreFile  = "file"
+	DurableStoreMySQL = "mysql"
+)
+
+var ErrUnknownTask = errors.New("task is not registered")
+
+// DurableTask task which can be stored, GetName is the name its decoder is registered with
+type DurableTask interface {
+	Task
+	MarshalTask() ([]byte, error)
+}
+
+// TaskDecoder restore task from data of MarshalTask
+type TaskDecoder func(data []byte) (Task, error)
+
+// TaskRegistry decoders of durable tasks by name
+type TaskRegistry struct {
+	mu       sync.RWMutex
+	decoders map[string]TaskDecoder
+}
+
+// NewTaskRegistry create empty registry
+func NewTaskRegistry() *TaskRegistry {
+	return &TaskRegistry{decoders: map[string]TaskDecoder{}}
+}
+
+// Register register decoder of tasks named name
+func (r *TaskRegistry) Register(name string, decoder TaskDecoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decoders[name] = decoder
+}
+
+// Decode restore task named name
+func (r *TaskRegistry) Decode(name string, data []byte) (Task, error) {
+	r.mu.RLock()
+	decoder, ok := r.decoders[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTask, name)
+	}
+	return decoder(data)
+}
+
+// DurableRecord stored task
+type DurableRecord struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Priority  int       `json:"priority"`
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DurableStore persistent store of queued tasks
+type DurableStore interface {
+	// Append store task before it is dispatched
+	Append(ctx context.Context, record DurableRecord) error
+	// Ack remove task once it is done
+	Ack(ctx context.Context, id string) error
+	// Pending tasks not acknowledged, in order of append
+	Pending(ctx context.Context) ([]DurableRecord, error)
+	Close() error
+}
+
+// DurableOptions durable queue options
+type DurableOptions struct {
+	// Store file or mysql, default file
+	Store string `json:"store" yaml:"store"`
+	// Path append-only file of file store
+	Path string `json:"path" yaml:"path"`
+	// Sync fsync file on every write
+	Sync bool `json:"sync" yaml:"sync"`
+	// CompactSize file size in bytes to compact acknowledged tasks away, default 64MB
+	CompactSize int64               `json:"compactSize" yaml:"compactSize"`
+	MySQL       *model.MySQLOptions `json:"mysql" yaml:"mysql"`
+	// Table table of mysql store, default pool_tasks
+	Table string `json:"table" yaml:"table"`
+}
+
+// BuildDurableStore create store by options
+func BuildDurableStore(options DurableOptions) (DurableStore, error) {
+	switch options.Store {
+	case "", DurableStoreFile:
+		return NewFileDurableStore(options.Path, options.Sync, options.CompactSize)
+	case DurableStoreMySQL:
+		if options.MySQL == nil {
+			return nil, fmt.Errorf("mysql options of durable store are missing")
+		}
+		return NewMySQLDurableStore(*options.MySQL, options.Table)
+	}
+	return nil, fmt.Errorf("unknown durable store %s", options.Store)
+}
+
+// DurablePool pool which stores tasks before they are dispatched and removes them once they are done.
+// Tasks not done when the process stops, or dropped by drop-oldest overflow, are dispatched again on startup, so a task may run more than once.
+type DurablePool struct {
+	*Pool
+	store    DurableStore
+	registry *TaskRegistry
+	acks     sync.WaitGroup
+	closed   sync.Once
+}
+
+// NewDurablePool create pool, tasks pending in store are decoded by registry and dispatched again
+func NewDurablePool(options Options, store DurableStore, registry *TaskRegistry, logger *logr.Logger) (*DurablePool, error) {
+	p := &DurablePool{Pool: NewWithOptions(options, logger), store: store, registry: registry}
+	if _, err := p.replay(context.Background()); err != nil {
+		p.Shutdown()
+		return nil, err
+	}
+	return p, nil
+}
+
+// SubmitDurable store task and queue it with options, it blocks while the queue is full and overflow policy is block
+func (p *DurablePool) SubmitDurable(task DurableTask, options ...DispatchOptions) (*Future, error) {
+	var o DispatchOptions
+	if len(options) > 0 {
+		o = options[0]
+	}
+	payload, err := task.MarshalTask()
+	if err != nil {
+		return nil, err
+	}
+	id, err := newRecordID()
+	if err != nil {
+		return nil, err
+	}
+	record := DurableRecord{ID: id, Name: task.GetName(), Priority: o.Priority, Payload: payload, CreatedAt: time.Now()}
+	if err := p.store.Append(context.Background(), record); err != nil {
+		return nil, err
+	}
+	f, err := p.dispatch(record, task, o, pushOverflow)
+	if err != nil {
+		// never queued
+		if ackErr := p.store.Ack(context.Background(), record.ID); ackErr != nil {
+			p.logger.Error(ackErr, "failed to remove rejected task from durable store", "record", record.ID)
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// dispatch queue task of record by mode, the record is acknowledged once the task is done
+func (p *DurablePool) dispatch(record DurableRecord, task Task, options DispatchOptions, mode pushMode) (*Future, error) {
+	f, err := p.enqueue(Adapt(task), mode, options)
+	if err != nil {
+		return nil, err
+	}
+	p.acks.Add(1)
+	go func() {
+		defer p.acks.Done()
+		<-f.Done()
+		p.ack(f.TaskStatus(), record.ID)
+	}()
+	return f, nil
+}
+
+// replay dispatch pending tasks of store, tasks without registered decoder are kept in store.
+// Replayed tasks wait for room in the queue whatever overflow policy is, so they are never rejected or dropped.
+func (p *DurablePool) replay(ctx context.Context) (int, error) {
+	records, err := p.store.Pending(ctx)
+	if err != nil {
+		return 0, err
+	}
+	replayed := 0
+	for _, record := range records {
+		task, err := p.registry.Decode(record.Name, record.Payload)
+		if err != nil {
+			p.logger.Error(err, "failed to decode durable task, it is kept in store", "record", record.ID, "task", record.Name)
+			continue
+		}
+		if _, err := p.dispatch(record, task, DispatchOptions{Priority: record.Priority}, pushBlock); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	if replayed > 0 {
+		p.logger.Info("durable tasks are replayed", "tasks", replayed)
+	}
+	return replayed, nil
+}
+
+// ack remove done task from store, tasks cancelled by shutdown or dropped from the full queue are kept for replay
+func (p *DurablePool) ack(status TaskStatus, id string) {
+	if status.State == TaskCancelled && p.shuttingDown.Load() {
+		p.logger.Info("task is cancelled by shutdown, it is kept in durable store", "task", status.ID, "record", id)
+		return
+	}
+	if errors.Is(status.Err, ErrTaskDropped) {
+		p.logger.Info("task is dropped from full queue, it is kept in durable store", "task", status.ID, "record", id)
+		return
+	}
+	if err := p.store.Ack(context.Background(), id); err != nil {
+		p.logger.Error(err, "failed to acknowledge durable task", "task", status.ID, "record", id)
+	}
+}
+
+// Shutdown shutdown pool and close store
+func (p *DurablePool) Shutdown() ShutdownSummary {
+	return p.ShutdownWithOptions(ShutdownOptions{Mode: ShutdownDrain})
+}
+
+// ShutdownWithOptions shutdown pool and close store, unstarted tasks of graceful shutdown are kept in store
+func (p *DurablePool) ShutdownWithOptions(options ShutdownOptions) ShutdownSummary {
+	summary := p.Pool.ShutdownWithOptions(options)
+	p.acks.Wait()
+	p.closed.Do(func() {
+		if err := p.store.Close(); err != nil {
+			p.logger.Error(err, "failed to close durable store")
+		}
+	})
+	return summary
+}
+
+func newRecordID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,204 @@
+package pool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	fileOpTask = "task"
+	fileOpAck  = "ack"
+
+	defaultCompactSize = 64 * 1024 * 1024
+)
+
+// fileEntry line of durable file, a task or the acknowledgement of a task
+type fileEntry struct {
+	Op string `json:"op"`
+	DurableRecord
+}
+
+// FileDurableStore append-only file of json lines, acknowledged tasks are compacted away on open
+// and whenever the file grows over compact size and twice the size of its last compaction
+type FileDurableStore struct {
+	mu          sync.Mutex
+	path        string
+	sync        bool
+	compactSize int64
+	size        int64
+	compacted   int64
+	file        *os.File
+}
+
+// NewFileDurableStore open durable file, it is created if not exist and compacted to pending tasks.
+// compactSize is the file size in bytes to compact again, default 64MB
+func NewFileDurableStore(path string, sync bool, compactSize int64) (*FileDurableStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path of durable file is missing")
+	}
+	if compactSize <= 0 {
+		compactSize = defaultCompactSize
+	}
+	s := &FileDurableStore{path: path, sync: sync, compactSize: compactSize}
+	if err := s.reopen(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reopen compact file to pending tasks and open it for append. The lock must be held or the store is not shared yet.
+func (s *FileDurableStore) reopen() error {
+	pending, err := s.read()
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			return err
+		}
+		s.file = nil
+	}
+	size, err := s.compact(pending)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.size = size
+	s.compacted = size
+	return nil
+}
+
+// Append implements DurableStore
+func (s *FileDurableStore) Append(ctx context.Context, record DurableRecord) error {
+	return s.write(fileEntry{Op: fileOpTask, DurableRecord: record})
+}
+
+// Ack implements DurableStore
+func (s *FileDurableStore) Ack(ctx context.Context, id string) error {
+	return s.write(fileEntry{Op: fileOpAck, DurableRecord: DurableRecord{ID: id}})
+}
+
+// Pending implements DurableStore
+func (s *FileDurableStore) Pending(ctx context.Context) ([]DurableRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
+
+// Close implements DurableStore
+func (s *FileDurableStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileDurableStore) write(entry fileEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return fmt.Errorf("durable file %s is not open", s.path)
+	}
+	n, err := s.file.Write(append(line, '\n'))
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if s.sync {
+		if err := s.file.Sync(); err != nil {
+			return err
+		}
+	}
+	if s.size >= s.compactSize && s.size >= 2*s.compacted {
+		return s.reopen()
+	}
+	return nil
+}
+
+// read pending tasks of file, a torn last line of a crash is ignored, any other malformed line is an error
+func (s *FileDurableStore) read() ([]DurableRecord, error) {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records := []DurableRecord{}
+	acked := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	var torn error
+	for scanner.Scan() {
+		line++
+		if torn != nil {
+			return nil, torn
+		}
+		var entry fileEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			torn = fmt.Errorf("durable file %s is corrupted at line %d: %w", s.path, line, err)
+			continue
+		}
+		switch entry.Op {
+		case fileOpTask:
+			records = append(records, entry.DurableRecord)
+		case fileOpAck:
+			acked[entry.ID] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	pending := records[:0]
+	for _, r := range records {
+		if !acked[r.ID] {
+			pending = append(pending, r)
+		}
+	}
+	return pending, nil
+}
+
+// compact rewrite file with pending tasks only, size of the new file is returned
+func (s *FileDurableStore) compact(pending []DurableRecord) (int64, error) {
+	tmp := s.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(file)
+	size := int64(0)
+	for _, r := range pending {
+		line, err := json.Marshal(fileEntry{Op: fileOpTask, DurableRecord: r})
+		if err != nil {
+			file.Close()
+			return 0, err
+		}
+		n, _ := w.Write(append(line, '\n'))
+		size += int64(n)
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+	return size, os.Rename(tmp, s.path)
+}
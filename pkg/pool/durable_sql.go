@@ -0,0 +1,99 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	model "github.com/af-go/peach-common/pkg/model/database"
+)
+
+const defaultDurableTable = "pool_tasks"
+
+// NewMySQLDurableStore open mysql/mariadb database and create table of tasks if not exist
+func NewMySQLDurableStore(options model.MySQLOptions, table string) (*SQLDurableStore, error) {
+	db, err := model.Open(options)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSQLDurableStore(db, table)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := s.Migrate(context.Background()); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSQLDurableStore create store on opened database, default table is pool_tasks.
+// Migrate uses mysql syntax, create the table before for other databases like sqlite.
+func NewSQLDurableStore(db *sql.DB, table string) (*SQLDurableStore, error) {
+	if table == "" {
+		table = defaultDurableTable
+	}
+	if err := model.ValidateTableName(table); err != nil {
+		return nil, err
+	}
+	return &SQLDurableStore{db: db, table: table}, nil
+}
+
+// SQLDurableStore durable store in a sql table, acknowledged tasks are deleted
+type SQLDurableStore struct {
+	db    *sql.DB
+	table string
+}
+
+// Migrate create mysql table if not exist
+func (s *SQLDurableStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	seq INTEGER PRIMARY KEY AUTO_INCREMENT,
+	id CHAR(32) NOT NULL UNIQUE,
+	name VARCHAR(255) NOT NULL,
+	priority INT NOT NULL DEFAULT 0,
+	payload MEDIUMBLOB,
+	created_at BIGINT NOT NULL
+)`, s.table))
+	return err
+}
+
+// Append implements DurableStore
+func (s *SQLDurableStore) Append(ctx context.Context, record DurableRecord) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id, name, priority, payload, created_at) VALUES (?, ?, ?, ?, ?)", s.table),
+		record.ID, record.Name, record.Priority, record.Payload, record.CreatedAt.UnixMilli())
+	return err
+}
+
+// Ack implements DurableStore
+func (s *SQLDurableStore) Ack(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = ?", s.table), id)
+	return err
+}
+
+// Pending implements DurableStore
+func (s *SQLDurableStore) Pending(ctx context.Context) ([]DurableRecord, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT id, name, priority, payload, created_at FROM %s ORDER BY seq", s.table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := []DurableRecord{}
+	for rows.Next() {
+		var r DurableRecord
+		var createdAt int64
+		if err := rows.Scan(&r.ID, &r.Name, &r.Priority, &r.Payload, &createdAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.UnixMilli(createdAt)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// Close implements DurableStore
+func (s *SQLDurableStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,204 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/af-go/peach-common/pkg/log"
+)
+
+type emailTask struct {
+	To      string `json:"to"`
+	release chan struct{}
+	sent    *sync.Map
+}
+
+func (m *emailTask) Run(id int) (interface{}, error) {
+	if m.release != nil {
+		<-m.release
+	}
+	m.sent.Store(m.To, true)
+	return nil, nil
+}
+
+func (m *emailTask) GetName() string {
+	return "email"
+}
+
+func (m *emailTask) MarshalTask() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func TestDurablePool(t *testing.T) {
+	logger := log.NewLogger(false)
+	path := filepath.Join(t.TempDir(), "tasks.log")
+	sent := &sync.Map{}
+	registry := NewTaskRegistry()
+	registry.Register("email", func(data []byte) (Task, error) {
+		task := emailTask{sent: sent}
+		return &task, json.Unmarshal(data, &task)
+	})
+	store, err := BuildDurableStore(DurableOptions{Path: path})
+	if err != nil {
+		t.Fatalf("failed to open durable store %v", err)
+	}
+	pool, err := NewDurablePool(Options{Name: "durable", MinRoutines: 1, MaxRoutines: 1}, store, registry, logger)
+	if err != nil {
+		t.Fatalf("failed to create durable pool %v", err)
+	}
+	done, _ := pool.SubmitDurable(&emailTask{To: "done", sent: sent})
+	done.Wait(context.Background())
+	release := make(chan struct{})
+	running, _ := pool.SubmitDurable(&emailTask{To: "running", release: release, sent: sent})
+	for running.Status() != TaskRunning {
+		time.Sleep(time.Millisecond)
+	}
+	pool.SubmitDurable(&emailTask{To: "queued", sent: sent})
+	time.AfterFunc(10*time.Millisecond, func() { close(release) })
+	summary := pool.ShutdownWithOptions(ShutdownOptions{Mode: ShutdownGraceful})
+	if len(summary.Unstarted) != 1 {
+		t.Fatalf("expect 1 unstarted task, actual %+v", summary)
+	}
+	if _, ok := sent.Load("queued"); ok {
+		t.Fatalf("expect queued task not run")
+	}
+
+	store, err = NewFileDurableStore(path, true, 0)
+	if err != nil {
+		t.Fatalf("failed to reopen durable store %v", err)
+	}
+	pending, _ := store.Pending(context.Background())
+	if len(pending) != 1 || pending[0].Name != "email" {
+		t.Fatalf("expect only unstarted task pending, actual %+v", pending)
+	}
+	pool, err = NewDurablePool(Options{Name: "durable", MinRoutines: 1, MaxRoutines: 1}, store, registry, logger)
+	if err != nil {
+		t.Fatalf("failed to create durable pool %v", err)
+	}
+	pool.Shutdown()
+	if _, ok := sent.Load("queued"); !ok {
+		t.Fatalf("expect unstarted task replayed on startup")
+	}
+	store, _ = NewFileDurableStore(path, false, 0)
+	defer store.Close()
+	if pending, _ := store.Pending(context.Background()); len(pending) != 0 {
+		t.Fatalf("expect no pending task, actual %+v", pending)
+	}
+}
+
+func TestDurableReplayOverflow(t *testing.T) {
+	logger := log.NewLogger(false)
+	for _, overflow := range []string{OverflowReject, OverflowDropOldest} {
+		path := filepath.Join(t.TempDir(), "tasks.log")
+		sent := &sync.Map{}
+		registry := NewTaskRegistry()
+		registry.Register("email", func(data []byte) (Task, error) {
+			task := emailTask{sent: sent}
+			return &task, json.Unmarshal(data, &task)
+		})
+		store, err := NewFileDurableStore(path, false, 0)
+		if err != nil {
+			t.Fatalf("failed to open durable store %v", err)
+		}
+		for i := 0; i < 5; i++ {
+			payload, _ := json.Marshal(emailTask{To: fmt.Sprintf("user-%d", i)})
+			if err := store.Append(context.Background(), DurableRecord{ID: fmt.Sprintf("r-%d", i), Name: "email", Payload: payload, CreatedAt: time.Now()}); err != nil {
+				t.Fatalf("failed to append record %v", err)
+			}
+		}
+		pool, err := NewDurablePool(Options{Name: "replay-" + overflow, MinRoutines: 1, MaxRoutines: 1, QueueCapacity: 1, Overflow: overflow}, store, registry, logger)
+		if err != nil {
+			t.Fatalf("%s: expect replay regardless of overflow policy, actual %v", overflow, err)
+		}
+		pool.Shutdown()
+		for i := 0; i < 5; i++ {
+			if _, ok := sent.Load(fmt.Sprintf("user-%d", i)); !ok {
+				t.Fatalf("%s: expect replayed task user-%d run", overflow, i)
+			}
+		}
+	}
+}
+
+func TestDurableDropOldest(t *testing.T) {
+	logger := log.NewLogger(false)
+	path := filepath.Join(t.TempDir(), "tasks.log")
+	sent := &sync.Map{}
+	store, err := NewFileDurableStore(path, false, 0)
+	if err != nil {
+		t.Fatalf("failed to open durable store %v", err)
+	}
+	pool, err := NewDurablePool(Options{Name: "drop-oldest", MinRoutines: 1, MaxRoutines: 1, QueueCapacity: 1, Overflow: OverflowDropOldest}, store, NewTaskRegistry(), logger)
+	if err != nil {
+		t.Fatalf("failed to create durable pool %v", err)
+	}
+	release := make(chan struct{})
+	running, _ := pool.SubmitDurable(&emailTask{To: "running", release: release, sent: sent})
+	for running.Status() != TaskRunning {
+		time.Sleep(time.Millisecond)
+	}
+	dropped, _ := pool.SubmitDurable(&emailTask{To: "dropped", sent: sent})
+	pool.SubmitDurable(&emailTask{To: "queued", sent: sent})
+	dropped.Wait(context.Background())
+	if status := dropped.TaskStatus(); !errors.Is(status.Err, ErrTaskDropped) {
+		t.Fatalf("expect oldest task dropped, actual %+v", status)
+	}
+	close(release)
+	pool.Shutdown()
+
+	store, _ = NewFileDurableStore(path, false, 0)
+	defer store.Close()
+	pending, _ := store.Pending(context.Background())
+	if len(pending) != 1 || string(pending[0].Payload) != `{"to":"dropped"}` {
+		t.Fatalf("expect dropped task kept in store, actual %+v", pending)
+	}
+}
+
+func TestFileDurableStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.log")
+	store, err := NewFileDurableStore(path, false, 1024)
+	if err != nil {
+		t.Fatalf("failed to open durable store %v", err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("r-%d", i)
+		if err := store.Append(ctx, DurableRecord{ID: id, Name: "email", Payload: []byte(`{}`)}); err != nil {
+			t.Fatalf("failed to append record %v", err)
+		}
+		if i > 0 {
+			if err := store.Ack(ctx, id); err != nil {
+				t.Fatalf("failed to ack record %v", err)
+			}
+		}
+	}
+	if info, _ := os.Stat(path); info.Size() > 2048 {
+		t.Fatalf("expect file compacted over compact size, actual %d bytes", info.Size())
+	}
+	if pending, _ := store.Pending(ctx); len(pending) != 1 || pending[0].ID != "r-0" {
+		t.Fatalf("expect r-0 pending after compaction, actual %+v", pending)
+	}
+	store.Close()
+
+	content, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, append(content, `{"op":"task","id":"torn"`...), 0o600); err != nil {
+		t.Fatalf("failed to write torn line %v", err)
+	}
+	if store, err = NewFileDurableStore(path, false, 0); err != nil {
+		t.Fatalf("expect torn last line ignored, actual %v", err)
+	}
+	store.Close()
+
+	if err := os.WriteFile(path, append([]byte("garbage\n"), content...), 0o600); err != nil {
+		t.Fatalf("failed to write corrupted line %v", err)
+	}
+	if _, err = NewFileDurableStore(path, false, 0); err == nil {
+		t.Fatalf("expect error for corrupted line before the last line")
+	}
+}
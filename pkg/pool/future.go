@@ -0,0 +1,149 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// TaskState state of a dispatched task
+type TaskState string
+
+const (
+	TaskQueued    TaskState = "queued"
+	TaskRunning   TaskState = "running"
+	TaskSucceeded TaskState = "succeeded"
+	TaskFailed    TaskState = "failed"
+	TaskCancelled TaskState = "cancelled"
+)
+
+// Done whether the task will not change state any more
+func (s TaskState) Done() bool {
+	return s == TaskSucceeded || s == TaskFailed || s == TaskCancelled
+}
+
+// Future handle of a dispatched task
+type Future = TypedFuture[interface{}]
+
+// TypedFuture handle of a dispatched task with result of type Out
+type TypedFuture[Out any] struct {
+	id     string
+	mu     sync.Mutex
+	state  TaskState
+	status TypedStatus[Out]
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newFuture[Out any](id string, name string) *TypedFuture[Out] {
+	return &TypedFuture[Out]{id: id, state: TaskQueued, status: TypedStatus[Out]{ID: id, Name: name, State: TaskQueued}, done: make(chan struct{})}
+}
+
+// ID id of task
+func (f *TypedFuture[Out]) ID() string {
+	return f.id
+}
+
+// Done closed when the task is done
+func (f *TypedFuture[Out]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Status current state of task
+func (f *TypedFuture[Out]) Status() TaskState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+// Wait wait until the task is done or ctx is done
+func (f *TypedFuture[Out]) Wait(ctx context.Context) (TypedStatus[Out], error) {
+	select {
+	case <-f.done:
+		return f.TaskStatus(), nil
+	case <-ctx.Done():
+		return f.TaskStatus(), ctx.Err()
+	}
+}
+
+// Result wait until the task is done, return data and error of task
+func (f *TypedFuture[Out]) Result() (Out, error) {
+	<-f.done
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status.Data, f.status.Err
+}
+
+// TaskStatus snapshot of task status
+func (f *TypedFuture[Out]) TaskStatus() TypedStatus[Out] {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status
+}
+
+// start mark task running, false is returned if the task is cancelled
+func (f *TypedFuture[Out]) start(status TypedStatus[Out], cancel context.CancelFunc) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state.Done() {
+		return false
+	}
+	f.state = TaskRunning
+	status.State = TaskRunning
+	f.status = status
+	f.cancel = cancel
+	return true
+}
+
+// retry mark running task queued for the next attempt, false is returned if the task is not running
+func (f *TypedFuture[Out]) retry(status TypedStatus[Out]) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state != TaskRunning {
+		return false
+	}
+	f.state = TaskQueued
+	status.State = TaskQueued
+	f.status = status
+	return true
+}
+
+// cancelTask complete a queued task as cancelled or cancel context of running task
+func (f *TypedFuture[Out]) cancelTask() (status TypedStatus[Out], queued bool, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch f.state {
+	case TaskQueued:
+		return f.finish(TypedStatus[Out]{ID: f.id, Name: f.status.Name, AssignTime: f.status.AssignTime, Err: ErrTaskCancelled}), true, true
+	case TaskRunning:
+		f.cancel()
+		return f.status, false, true
+	}
+	return f.status, false, false
+}
+
+// complete set final status, state is derived from error of status. False is returned if the task is already done.
+func (f *TypedFuture[Out]) complete(status TypedStatus[Out]) (TypedStatus[Out], bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state.Done() {
+		return f.status, false
+	}
+	return f.finish(status), true
+}
+
+// finish set final status, the lock must be held
+func (f *TypedFuture[Out]) finish(status TypedStatus[Out]) TypedStatus[Out] {
+	switch {
+	case status.Err == nil:
+		status.State = TaskSucceeded
+	case errors.Is(status.Err, ErrTaskDropped), errors.Is(status.Err, ErrTaskCancelled), errors.Is(status.Err, ErrShuttingDown):
+		status.State = TaskCancelled
+	default:
+		status.State = TaskFailed
+	}
+	f.state = status.State
+	f.status = status
+	close(f.done)
+	return status
+}
@@ -0,0 +1,47 @@
+package pool
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// poolMetrics metrics of running pools by name, published with expvar
+var poolMetrics = expvar.NewMap("peach_pool")
+
+// metricsMu serialize name allocation of pool metrics
+var metricsMu sync.Mutex
+
+// newMetrics publish gauges of pool under a unique name, name-2, name-3 and so on are used when name is taken by a running pool.
+// Counters are added to the returned map.
+func newMetrics[Out any](name string, p *engine[Out]) (string, *expvar.Map) {
+	m := new(expvar.Map).Init()
+	m.Set("routines", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&p.routines)
+	}))
+	m.Set("busy", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&p.busy)
+	}))
+	m.Set("queued", expvar.Func(func() interface{} {
+		return p.queue.len()
+	}))
+	m.Set("stats", expvar.Func(func() interface{} {
+		return p.Stats()
+	}))
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	unique := name
+	for i := 2; poolMetrics.Get(unique) != nil; i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+	poolMetrics.Set(unique, m)
+	return unique, m
+}
+
+// removeMetrics unpublish metrics of a shut down pool, so the pool is no longer reachable from expvar
+func removeMetrics(name string) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	poolMetrics.Delete(name)
+}
@@ -1,30 +1,37 @@
-/*
-*
-TODO need work with a Queue
-*/
 package pool
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
-	"gonum.org/v1/gonum/stat"
 )
 
 const (
 	increaseSignal  = 1
 	decreaseSingal  = 2
 	shutodownSignal = 3
+
+	defaultPoolName      = "default"
+	defaultScaleInterval = time.Second
+	defaultIdleTimeout   = 30 * time.Second
 )
 
-type internalTask struct {
+type internalTask[Out any] struct {
 	id         string
 	AssignTime time.Time
 	StartTime  time.Time
-	task       Task
+	task       TypedTask[Out]
+	timeout    time.Duration
+	options    DispatchOptions
+	retry      *RetryPolicy
+	attempts   []TaskAttempt
+	future     *TypedFuture[Out]
 }
 
 // Task task interface
@@ -34,86 +41,198 @@ type Task interface {
 }
 
 // TaskStatus task status
-type TaskStatus struct {
+type TaskStatus = TypedStatus[interface{}]
+
+// TypedStatus status of task with result of type Out
+type TypedStatus[Out any] struct {
 	Name       string
 	ID         string
+	State      TaskState
 	Err        error
-	Data       interface{}
+	Data       Out
 	Executor   string
 	AssignTime time.Time
 	StartTime  time.Time
 	Duration   time.Duration
+	// Attempts runs of task, the last one is the result
+	Attempts []TaskAttempt
+}
+
+// Options pool options
+type Options struct {
+	MinRoutines int           `json:"minRoutines" yaml:"minRoutines"`
+	MaxRoutines int           `json:"maxRoutines" yaml:"maxRoutines"`
+	Timeout     time.Duration `json:"timeout" yaml:"timeout"`
+	// QueueCapacity max queued tasks, 0 means unbounded
+	QueueCapacity int `json:"queueCapacity" yaml:"queueCapacity"`
+	// Overflow block, reject or drop-oldest when the queue is full, default block
+	Overflow string `json:"overflow" yaml:"overflow"`
+	// Name name of pool metrics, default default, a suffix like -2 is added if the name is taken by a running pool
+	Name string `json:"name" yaml:"name"`
+	// ScaleInterval how often routines are scaled between MinRoutines and MaxRoutines, default 1s
+	ScaleInterval time.Duration `json:"scaleInterval" yaml:"scaleInterval"`
+	// ScaleUpQueueDepth routines are added when more tasks are queued, default 0
+	ScaleUpQueueDepth int `json:"scaleUpQueueDepth" yaml:"scaleUpQueueDepth"`
+	// ScaleUpWait routines are added when the oldest queued task waited longer, 0 means queue depth only
+	ScaleUpWait time.Duration `json:"scaleUpWait" yaml:"scaleUpWait"`
+	// IdleTimeout idle routines above MinRoutines are stopped when no task is queued for so long, default 30s
+	IdleTimeout time.Duration `json:"idleTimeout" yaml:"idleTimeout"`
+	// TaskTimeout default deadline of a task, 0 means no deadline
+	TaskTimeout time.Duration `json:"taskTimeout" yaml:"taskTimeout"`
+	// ShutdownGracePeriod running tasks are cancelled if Shutdown takes longer, 0 means wait for all tasks
+	ShutdownGracePeriod time.Duration `json:"shutdownGracePeriod" yaml:"shutdownGracePeriod"`
+	// Retry retry policy of tasks, nil means no retry
+	Retry *RetryPolicy `json:"retry" yaml:"retry"`
+	// Retention which results are kept, default the last 10000, long running pools must not retain all
+	Retention RetentionPolicy `json:"retention" yaml:"retention"`
+	// StatsSamples number of recent tasks for latency percentiles of Stats, default 1024
+	StatsSamples int `json:"statsSamples" yaml:"statsSamples"`
 }
 
-// Pool work pool
+// DispatchOptions options of a dispatched task
+type DispatchOptions struct {
+	// Priority tasks of higher priority run first, tasks of the same priority run in dispatch order
+	Priority int
+	// Timeout deadline of the task from its start, overrides TaskTimeout of pool
+	Timeout time.Duration
+	// Retry retry policy of the task, overrides Retry of pool
+	Retry *RetryPolicy
+}
+
+// Pool work pool of tasks with untyped result
 type Pool struct {
+	*engine[interface{}]
+}
+
+// engine routines, queue and results of pool with result of type Out
+type engine[Out any] struct {
 	logger          *logr.Logger
+	options         Options
+	ctx             context.Context
+	cancel          context.CancelFunc
 	minRoutines     int
 	maxRoutines     int
 	controlChannel  chan int
-	shutdownChannel chan struct{}
+	resizeChannel   chan int
+	shutdownChannel chan ShutdownOptions
+	shutdownOnce    sync.Once
+	summary         TypedShutdownSummary[Out]
+	unstarted       []TypedTask[Out]
+	stopped         chan struct{}
 	killChannel     chan struct{} //Channel used to kill goroutines
-	taskChannel     chan internalTask
-	statusChannel   chan TaskStatus
+	queue           *taskQueue[Out]
+	workers         sync.WaitGroup
+	statusChannel   chan TypedStatus[Out]
 	routines        int64 //number of current totla available routines
+	retiring        int64 //number of routines to stop once idle
+	busy            int64 //number of routines running a task
+	lastBusy        time.Time
+	metrics         *expvar.Map
+	metricsName     string
+	stats           *statsCollector
 	sequence        int
 	wg              sync.WaitGroup
-	tasksStatus     []TaskStatus
+	mu              sync.RWMutex
+	tasksStatus     []TypedStatus[Out]
+	futures         map[string]*TypedFuture[Out]
+	deadLetters     []TypedDeadLetter[Out]
+	subscribers     []*subscriber[Out]
+	resultsClosed   bool
+	onComplete      []func(TypedStatus[Out])
+	onError         []func(TypedStatus[Out])
+	retrying        sync.WaitGroup
 	count           int64 //number to total tasks
 	timeout         time.Duration
-	shuttingDown    bool
+	shuttingDown    atomic.Bool
+	abandoned       int64 //number of tasks left running after their context is done
+	succeeded       int64
+	failed          int64
+	cancelled       int64
 	taskSequence    int64
 }
 
-// New create new pool
+// New create new pool with unbounded queue
 func New(minRoutines int, maxRoutines int, timeout time.Duration, logger *logr.Logger) *Pool {
-	pool := Pool{
-		minRoutines:     minRoutines,
-		maxRoutines:     maxRoutines,
+	return NewWithOptions(Options{MinRoutines: minRoutines, MaxRoutines: maxRoutines, Timeout: timeout}, logger)
+}
+
+// NewWithOptions create new pool
+func NewWithOptions(options Options, logger *logr.Logger) *Pool {
+	return &Pool{engine: newEngine[interface{}](options, logger)}
+}
+
+func newEngine[Out any](options Options, logger *logr.Logger) *engine[Out] {
+	if options.Name == "" {
+		options.Name = defaultPoolName
+	}
+	if options.ScaleInterval <= 0 {
+		options.ScaleInterval = defaultScaleInterval
+	}
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = defaultIdleTimeout
+	}
+	if options.Retention.Mode == "" {
+		options.Retention.Mode = RetainLast
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := engine[Out]{
+		options:         options,
+		ctx:             ctx,
+		cancel:          cancel,
+		minRoutines:     options.MinRoutines,
+		maxRoutines:     options.MaxRoutines,
 		controlChannel:  make(chan int),
-		taskChannel:     make(chan internalTask),
-		shutdownChannel: make(chan struct{}),
+		resizeChannel:   make(chan int),
+		queue:           newTaskQueue[Out](options.QueueCapacity, options.Overflow),
+		shutdownChannel: make(chan ShutdownOptions),
+		stopped:         make(chan struct{}),
 		killChannel:     make(chan struct{}),
-		statusChannel:   make(chan TaskStatus),
-		tasksStatus:     []TaskStatus{},
-		timeout:         timeout,
+		statusChannel:   make(chan TypedStatus[Out]),
+		tasksStatus:     []TypedStatus[Out]{},
+		futures:         map[string]*TypedFuture[Out]{},
+		stats:           newStatsCollector(options.StatsSamples),
+		timeout:         options.Timeout,
 		logger:          logger,
 	}
 	pool.init()
 	return &pool
 }
 
-func (p *Pool) init() {
+func (p *engine[Out]) init() {
 	if p.minRoutines < 1 {
 		p.minRoutines = 1
 	}
 	if p.maxRoutines < p.minRoutines {
-		p.minRoutines = p.maxRoutines
+		p.maxRoutines = p.minRoutines
 	}
+	p.metricsName, p.metrics = newMetrics(p.options.Name, p)
+	p.lastBusy = time.Now()
 	p.startDaemon()
 	p.add(p.minRoutines)
 	p.resultRoutine()
 }
 
-func (p *Pool) resultRoutine() {
+func (p *engine[Out]) resultRoutine() {
 	p.wg.Add(1)
 	go func() {
 		for {
 			select {
 			case s := <-p.statusChannel:
-				p.tasksStatus = append(p.tasksStatus, s)
+				p.deliver(s)
 				p.logger.V(0).Info("task is done", "task", s.Name)
 				atomic.AddInt64(&p.count, -1)
 			case <-p.killChannel:
 				p.logger.Info("summay channel is killed")
+				p.closeResults()
 				p.wg.Done()
+				return
 			}
 		}
 	}()
 }
 
 // add create new routines
-func (p *Pool) add(routines int) {
+func (p *engine[Out]) add(routines int) {
 	p.logger.Info("tried to add routines", "routines", routines)
 	if routines <= 0 {
 		p.logger.V(0).Info("negative routines, ignore", "routines", routines)
@@ -124,90 +243,261 @@ func (p *Pool) add(routines int) {
 	}
 }
 
-// Dispatch submit a task
-func (p *Pool) Dispatch(task Task) string {
-	if p.shuttingDown {
-		p.logger.Info("Shutting down, no request accept")
-		return ""
+// Dispatch submit a task, it blocks while the queue is full and overflow policy is block. Nil is returned if the task is rejected.
+func (p *Pool) Dispatch(task Task) *Future {
+	f, err := p.Submit(task)
+	if err != nil {
+		p.logger.Info("task is rejected", "task", task.GetName(), "reason", err.Error())
+		return nil
+	}
+	return f
+}
+
+// Submit queue a task with options, it blocks while the queue is full and overflow policy is block
+func (p *Pool) Submit(task Task, options ...DispatchOptions) (*Future, error) {
+	return p.enqueue(Adapt(task), pushOverflow, options...)
+}
+
+// SubmitContext queue a context aware task with options, it blocks while the queue is full and overflow policy is block
+func (p *Pool) SubmitContext(task ContextTask, options ...DispatchOptions) (*Future, error) {
+	return p.SubmitTask(task, options...)
+}
+
+// TryDispatch queue a task without blocking, ErrQueueFull is returned if the queue is full and overflow policy is not drop-oldest
+func (p *Pool) TryDispatch(task Task, options ...DispatchOptions) (*Future, error) {
+	return p.enqueue(Adapt(task), pushNoWait, options...)
+}
+
+// SubmitTask queue a task with options, it blocks while the queue is full and overflow policy is block
+func (p *engine[Out]) SubmitTask(task TypedTask[Out], options ...DispatchOptions) (*TypedFuture[Out], error) {
+	return p.enqueue(task, pushOverflow, options...)
+}
+
+// TrySubmitTask queue a task without blocking, ErrQueueFull is returned if the queue is full and overflow policy is not drop-oldest
+func (p *engine[Out]) TrySubmitTask(task TypedTask[Out], options ...DispatchOptions) (*TypedFuture[Out], error) {
+	return p.enqueue(task, pushNoWait, options...)
+}
+
+func (p *engine[Out]) enqueue(task TypedTask[Out], mode pushMode, options ...DispatchOptions) (*TypedFuture[Out], error) {
+	if p.shuttingDown.Load() {
+		return nil, ErrShuttingDown
+	}
+	var o DispatchOptions
+	if len(options) > 0 {
+		o = options[0]
 	}
-	s := int(atomic.LoadInt64(&p.taskSequence))
-	atomic.AddInt64(&p.taskSequence, 1)
-	t := internalTask{id: fmt.Sprintf("%v", s), task: task, AssignTime: time.Now()}
-	p.taskChannel <- t
-	p.logger.Info("task assigned", "task", task.GetName())
+	s := atomic.AddInt64(&p.taskSequence, 1) - 1
+	t := internalTask[Out]{id: fmt.Sprintf("%v", s), task: task, AssignTime: time.Now(), timeout: p.options.TaskTimeout, options: o}
+	if o.Timeout > 0 {
+		t.timeout = o.Timeout
+	}
+	if o.Retry != nil {
+		t.retry = o.Retry.withDefaults()
+	} else if p.options.Retry != nil {
+		t.retry = p.options.Retry.withDefaults()
+	}
+	t.future = newFuture[Out](t.id, task.GetName())
+	t.future.status.AssignTime = t.AssignTime
+	p.mu.Lock()
+	p.futures[t.id] = t.future
+	p.mu.Unlock()
 	atomic.AddInt64(&p.count, 1)
-	return t.id
+	dropped, err := p.queue.push(t, o.Priority, mode)
+	if err != nil {
+		atomic.AddInt64(&p.count, -1)
+		p.mu.Lock()
+		delete(p.futures, t.id)
+		p.mu.Unlock()
+		return nil, err
+	}
+	p.logger.Info("task assigned", "task", task.GetName(), "priority", o.Priority)
+	p.drop(dropped)
+	return t.future, nil
+}
+
+// drop complete task dropped from full queue
+func (p *engine[Out]) drop(dropped *internalTask[Out]) {
+	if dropped == nil {
+		return
+	}
+	p.logger.Info("task is dropped from full queue", "task", dropped.id)
+	if status, ok := dropped.future.complete(TypedStatus[Out]{ID: dropped.id, Name: dropped.task.GetName(), AssignTime: dropped.AssignTime, Err: ErrTaskDropped, Attempts: dropped.attempts}); ok {
+		p.statusChannel <- status
+	}
+}
+
+// Lookup get future of task by id
+func (p *engine[Out]) Lookup(id string) (*TypedFuture[Out], bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	f, ok := p.futures[id]
+	return f, ok
 }
 
-func (p *Pool) execute(id int) {
+// Status get state of task by id
+func (p *engine[Out]) Status(id string) (TaskState, bool) {
+	f, ok := p.Lookup(id)
+	if !ok {
+		return "", false
+	}
+	return f.Status(), true
+}
+
+// Cancel cancel task by id, a queued task never runs and a running task sees its context cancelled.
+// False is returned if the task is unknown or done.
+func (p *engine[Out]) Cancel(id string) bool {
+	f, ok := p.Lookup(id)
+	if !ok {
+		return false
+	}
+	status, queued, ok := f.cancelTask()
+	if queued {
+		p.logger.Info("queued task is cancelled", "task", id)
+		p.statusChannel <- status
+	}
+	return ok
+}
+
+// Queued number of tasks waiting for a routine
+func (p *engine[Out]) Queued() int {
+	return p.queue.len()
+}
+
+func (p *engine[Out]) execute(id int) {
 	p.logger.Info("start routine", "routine", id)
 	for {
-		select {
-		case t := <-p.taskChannel:
-			p.logger.Info("run task in routine", "task", t.id, "routine", id)
-			t.StartTime = time.Now()
-			result := TaskStatus{ID: t.id, Name: t.task.GetName(), AssignTime: t.AssignTime}
-			result.Data, result.Err = t.task.Run(id)
-			result.Executor = fmt.Sprintf("routine %v", id)
-			result.Duration = time.Since(t.StartTime)
-			p.statusChannel <- result
-			p.logger.Info("task in routine is done", "task", t.id, "routine", id)
-		case <-p.killChannel:
+		t, ok := p.queue.pop(p.shouldRetire)
+		if !ok {
 			atomic.AddInt64(&p.routines, -1)
+			p.workers.Done()
 			p.wg.Done()
-			p.logger.Info("routine is killed", "routine", id)
+			p.logger.Info("routine is stopped", "routine", id)
 			return
 		}
+		p.run(t, id)
 	}
+}
 
+// run run task in routine, the task is skipped if it is cancelled while queued
+func (p *engine[Out]) run(t internalTask[Out], id int) {
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+	if t.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+	t.StartTime = time.Now()
+	result := TypedStatus[Out]{ID: t.id, Name: t.task.GetName(), AssignTime: t.AssignTime, StartTime: t.StartTime}
+	if ctx.Err() != nil {
+		// cancelled by shutdown before it started
+		result.Err = contextError(ctx)
+		p.finish(t, result)
+		return
+	}
+	if !t.future.start(result, cancel) {
+		return
+	}
+	p.logger.Info("run task in routine", "task", t.id, "routine", id)
+	atomic.AddInt64(&p.busy, 1)
+	var abandoned bool
+	result.Data, result.Err, abandoned = runTask(ctx, t.task, id)
+	atomic.AddInt64(&p.busy, -1)
+	if abandoned {
+		atomic.AddInt64(&p.abandoned, 1)
+		p.logger.Info("task ignoring context is abandoned", "task", t.id, "routine", id)
+	}
+	result.Executor = fmt.Sprintf("routine %v", id)
+	result.Duration = time.Since(t.StartTime)
+	var panicErr *PanicError
+	if errors.As(result.Err, &panicErr) {
+		p.logger.Error(result.Err, "task panicked", "task", t.id, "routine", id, "stack", panicErr.Stack)
+	}
+	t.attempts = append(t.attempts, TaskAttempt{Attempt: len(t.attempts) + 1, Executor: result.Executor, StartTime: t.StartTime, Duration: result.Duration, Err: result.Err})
+	result.Attempts = t.attempts
+	if result.Err != nil && t.retry != nil && len(t.attempts) < t.retry.MaxAttempts && !errors.Is(result.Err, ErrTaskCancelled) && t.retry.Retryable(result.Err) && p.ctx.Err() == nil {
+		p.scheduleRetry(t, result)
+		return
+	}
+	p.finish(t, result)
+	p.logger.Info("task in routine is done", "task", t.id, "routine", id)
+}
+
+// finish complete task, failed task with retry policy is kept in dead letters
+func (p *engine[Out]) finish(t internalTask[Out], result TypedStatus[Out]) {
+	result, ok := t.future.complete(result)
+	if !ok {
+		return
+	}
+	if result.State == TaskFailed && t.retry != nil {
+		p.logger.Info("task is moved to dead letters", "task", t.id, "attempts", len(t.attempts), "error", result.Err.Error())
+		p.mu.Lock()
+		p.deadLetters = append(p.deadLetters, TypedDeadLetter[Out]{Task: t.task, Status: result, Options: t.options})
+		p.mu.Unlock()
+	}
+	p.statusChannel <- result
+}
+
+// scheduleRetry queue task again after backoff, the task fails with its last error if the pool is shut down meanwhile
+func (p *engine[Out]) scheduleRetry(t internalTask[Out], result TypedStatus[Out]) {
+	backoff := t.retry.backoff(len(t.attempts))
+	p.logger.Info("retry task", "task", t.id, "attempt", len(t.attempts), "backoff", backoff.String(), "error", result.Err.Error())
+	if !t.future.retry(result) {
+		// cancelled meanwhile
+		p.finish(t, result)
+		return
+	}
+	p.retrying.Add(1)
+	go func() {
+		defer p.retrying.Done()
+		select {
+		case <-time.After(backoff):
+			dropped, err := p.queue.push(t, t.options.Priority, pushOverflow)
+			if err == nil {
+				p.drop(dropped)
+				return
+			}
+		case <-p.stopped:
+		}
+		p.finish(t, result)
+	}()
+}
+
+// shouldRetire whether the calling idle routine should stop, called by routines waiting for tasks
+func (p *engine[Out]) shouldRetire() bool {
+	for {
+		r := atomic.LoadInt64(&p.retiring)
+		if r <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&p.retiring, r, r-1) {
+			return true
+		}
+	}
 }
 
 // startDaemon start daemon routine for pool
-func (p *Pool) startDaemon() {
+func (p *engine[Out]) startDaemon() {
 	p.wg.Add(1)
 	go func() {
+		ticker := time.NewTicker(p.options.ScaleInterval)
+		defer ticker.Stop()
 		for {
 			select {
 			case c := <-p.controlChannel:
 				switch c {
 				case increaseSignal:
 					p.logger.Info("increase signal is received")
-					p.sequence++
-					p.wg.Add(1)
-					atomic.AddInt64(&p.routines, 1)
-					go p.execute(p.sequence)
-
+					p.spawn()
 				case decreaseSingal:
 					p.logger.Info("decrease signal is received")
+					p.retire(1)
 				}
-			case <-p.shutdownChannel:
-				p.logger.Info("shutdown signal is received")
-				p.shuttingDown = true
-				var c int
-
-				for i := 0; i < 30; i++ {
-					c = int(atomic.LoadInt64(&p.count))
-					p.logger.Info("running tasks", "tasks", c)
-					if c == 0 {
-						break
-					}
-					// use mean value of tasks execution time, in case some tasks are very slowly
-					averageDuration, err := time.ParseDuration(fmt.Sprintf("%vs", p.mean()))
-					if err != nil {
-						time.Sleep(p.timeout)
-					} else {
-						time.Sleep(averageDuration)
-					}
-				}
-				if c > 0 {
-					p.logger.Error(fmt.Errorf("timeout"), "tasks", c)
-				}
-				routines := int(atomic.LoadInt64(&p.routines))
-				p.logger.Info("working routines, killing", "routines", routines)
-				for i := 0; i < routines; i++ {
-					p.killChannel <- struct{}{}
-				}
-				p.killChannel <- struct{}{}
+			case n := <-p.resizeChannel:
+				p.resize(n)
+			case <-ticker.C:
+				p.autoscale()
+			case options := <-p.shutdownChannel:
+				p.shutdown(options)
 				p.wg.Done()
 				return
 			}
@@ -215,21 +505,97 @@ func (p *Pool) startDaemon() {
 	}()
 }
 
-func (p *Pool) mean() float64 {
-	s := []float64{}
-	for _, taskStatus := range p.tasksStatus {
-		s = append(s, taskStatus.Duration.Seconds())
+// spawn start a routine, called by daemon
+func (p *engine[Out]) spawn() {
+	p.sequence++
+	p.wg.Add(1)
+	p.workers.Add(1)
+	atomic.AddInt64(&p.routines, 1)
+	go p.execute(p.sequence)
+}
+
+// retire stop n routines once they are idle, called by daemon
+func (p *engine[Out]) retire(n int) {
+	atomic.AddInt64(&p.retiring, int64(n))
+	p.queue.wake()
+}
+
+// active number of routines not retiring
+func (p *engine[Out]) active() int {
+	return int(atomic.LoadInt64(&p.routines) - atomic.LoadInt64(&p.retiring))
+}
+
+// autoscale add routines when tasks queue up, stop idle routines after IdleTimeout, called by daemon
+func (p *engine[Out]) autoscale() {
+	now := time.Now()
+	queued := p.queue.len()
+	routines := p.active()
+	busy := int(atomic.LoadInt64(&p.busy))
+	if queued > 0 || busy >= routines {
+		p.lastBusy = now
+	}
+	wait := p.queue.oldestWait(now)
+	if routines < p.maxRoutines && (queued > p.options.ScaleUpQueueDepth || p.options.ScaleUpWait > 0 && wait > p.options.ScaleUpWait) {
+		n := min(max(queued-p.options.ScaleUpQueueDepth, 1), p.maxRoutines-routines)
+		p.logger.Info("scale up routines", "routines", routines, "added", n, "queued", queued, "wait", wait.String())
+		p.metrics.Add("scale_up", int64(n))
+		for i := 0; i < n; i++ {
+			p.spawn()
+		}
+		return
+	}
+	if routines > p.minRoutines && queued == 0 && now.Sub(p.lastBusy) >= p.options.IdleTimeout {
+		n := min(routines-busy, routines-p.minRoutines)
+		if n <= 0 {
+			return
+		}
+		p.logger.Info("scale down idle routines", "routines", routines, "removed", n)
+		p.metrics.Add("scale_down", int64(n))
+		p.retire(n)
+		p.lastBusy = now
+	}
+}
+
+// resize set routines to n and widen the scaling range to include n, called by daemon
+func (p *engine[Out]) resize(n int) {
+	routines := p.active()
+	p.minRoutines = min(p.minRoutines, n)
+	p.maxRoutines = max(p.maxRoutines, n)
+	p.logger.Info("resize routines", "routines", routines, "target", n)
+	if n > routines {
+		for i := 0; i < n-routines; i++ {
+			p.spawn()
+		}
+	} else if n < routines {
+		p.retire(routines - n)
+	}
+	p.lastBusy = time.Now()
+}
+
+// Resize set number of routines to n, the autoscaling range is widened to include n. Surplus routines stop once they are idle.
+func (p *engine[Out]) Resize(n int) error {
+	if n < 1 {
+		return fmt.Errorf("invalid number of routines %d", n)
+	}
+	select {
+	case p.resizeChannel <- n:
+		return nil
+	case <-p.stopped:
+		return ErrShuttingDown
 	}
-	return stat.Mean(s, nil)
 }
 
-// Shutdown stutdown pool
-func (p *Pool) Shutdown() {
-	p.shutdownChannel <- struct{}{}
-	p.wg.Wait()
+// Routines number of running routines
+func (p *engine[Out]) Routines() int {
+	return int(atomic.LoadInt64(&p.routines))
 }
 
-// GetResult get tasks result of pool
-func (p *Pool) GetResult() *[]TaskStatus {
-	return &p.tasksStatus
+// GetResult get copy of done tasks result kept by retention policy
+func (p *engine[Out]) GetResult() *[]TypedStatus[Out] {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.evict(time.Now())
+	result := make([]TypedStatus[Out], len(p.tasksStatus))
+	copy(result, p.tasksStatus)
+	return &result
 }
@@ -1,7 +1,12 @@
 package pool
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -57,3 +62,540 @@ func TestPool(t *testing.T) {
 		t.Errorf("Failed, Except %v , actual %v ", 40*len(names), len(result))
 	}
 }
+
+type recordTask struct {
+	name    string
+	release chan struct{}
+	ran     chan string
+}
+
+func (m *recordTask) Run(id int) (interface{}, error) {
+	if m.release != nil {
+		<-m.release
+	}
+	m.ran <- m.name
+	return m.name, nil
+}
+
+func (m *recordTask) GetName() string {
+	return m.name
+}
+
+func TestPoolQueue(t *testing.T) {
+	logger := log.NewLogger(false)
+	ran := make(chan string, 10)
+	release := make(chan struct{})
+	pool := NewWithOptions(Options{MinRoutines: 1, MaxRoutines: 1, QueueCapacity: 3, Overflow: OverflowReject}, logger)
+	pool.Dispatch(&recordTask{name: "blocker", release: release, ran: ran})
+	for pool.Queued() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i, priority := range []int{0, 5, 1} {
+		if _, err := pool.TryDispatch(&recordTask{name: fmt.Sprintf("task-%d", i), ran: ran}, DispatchOptions{Priority: priority}); err != nil {
+			t.Fatalf("failed to dispatch task %v", err)
+		}
+	}
+	if _, err := pool.Submit(&recordTask{name: "overflow", ran: ran}); err != ErrQueueFull {
+		t.Fatalf("expect ErrQueueFull, actual %v", err)
+	}
+	close(release)
+	pool.Shutdown()
+	close(ran)
+	order := []string{}
+	for name := range ran {
+		order = append(order, name)
+	}
+	if fmt.Sprint(order) != "[blocker task-1 task-2 task-0]" {
+		t.Fatalf("expect tasks run by priority, actual %v", order)
+	}
+	if _, err := pool.TryDispatch(&recordTask{name: "late", ran: ran}); err != ErrShuttingDown {
+		t.Fatalf("expect ErrShuttingDown, actual %v", err)
+	}
+}
+
+func TestPoolDropOldest(t *testing.T) {
+	logger := log.NewLogger(false)
+	ran := make(chan string, 10)
+	release := make(chan struct{})
+	pool := NewWithOptions(Options{MinRoutines: 1, MaxRoutines: 1, QueueCapacity: 2, Overflow: OverflowDropOldest}, logger)
+	pool.Dispatch(&recordTask{name: "blocker", release: release, ran: ran})
+	for pool.Queued() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	pool.Dispatch(&recordTask{name: "old", ran: ran})
+	pool.Dispatch(&recordTask{name: "next", ran: ran})
+	if _, err := pool.TryDispatch(&recordTask{name: "new", ran: ran}); err != nil {
+		t.Fatalf("expect oldest task dropped instead of rejecting, actual %v", err)
+	}
+	close(release)
+	pool.Shutdown()
+	dropped := 0
+	for _, s := range *pool.GetResult() {
+		if s.Err == ErrTaskDropped {
+			dropped++
+			if s.Name != "old" {
+				t.Fatalf("expect oldest task dropped, actual %s", s.Name)
+			}
+		}
+	}
+	if dropped != 1 || len(*pool.GetResult()) != 4 {
+		t.Fatalf("expect 1 dropped of 4 results, actual %d of %d", dropped, len(*pool.GetResult()))
+	}
+}
+
+func waitRoutines(t *testing.T, pool *Pool, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Routines() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect %d routines, actual %d", n, pool.Routines())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPoolAutoscale(t *testing.T) {
+	logger := log.NewLogger(false)
+	ran := make(chan string, 10)
+	release := make(chan struct{})
+	pool := NewWithOptions(Options{Name: "autoscale", MinRoutines: 1, MaxRoutines: 4, ScaleInterval: 10 * time.Millisecond, IdleTimeout: 50 * time.Millisecond}, logger)
+	for i := 0; i < 6; i++ {
+		pool.Dispatch(&recordTask{name: fmt.Sprintf("task-%d", i), release: release, ran: ran})
+	}
+	waitRoutines(t, pool, 4)
+	close(release)
+	waitRoutines(t, pool, 1)
+	if err := pool.Resize(3); err != nil {
+		t.Fatalf("failed to resize pool %v", err)
+	}
+	waitRoutines(t, pool, 3)
+	m := poolMetrics.Get("autoscale").(*expvar.Map)
+	if m.Get("scale_up").String() != "3" || m.Get("scale_down").String() != "3" {
+		t.Fatalf("expect 3 routines scaled up and down, actual %v and %v", m.Get("scale_up"), m.Get("scale_down"))
+	}
+	pool.Shutdown()
+	if len(*pool.GetResult()) != 6 {
+		t.Fatalf("expect 6 results, actual %d", len(*pool.GetResult()))
+	}
+	if err := pool.Resize(2); err != ErrShuttingDown {
+		t.Fatalf("expect ErrShuttingDown, actual %v", err)
+	}
+}
+
+type failTask struct{}
+
+func (m *failTask) Run(id int) (interface{}, error) {
+	return nil, errors.New("failed")
+}
+
+func (m *failTask) GetName() string {
+	return "fail"
+}
+
+func TestPoolFuture(t *testing.T) {
+	logger := log.NewLogger(false)
+	ran := make(chan string, 10)
+	release := make(chan struct{})
+	pool := NewWithOptions(Options{Name: "future", MinRoutines: 1, MaxRoutines: 1}, logger)
+	blocker := pool.Dispatch(&recordTask{name: "blocker", release: release, ran: ran})
+	queued := pool.Dispatch(&recordTask{name: "queued", ran: ran})
+	failed := pool.Dispatch(&failTask{})
+	for blocker.Status() != TaskRunning {
+		time.Sleep(time.Millisecond)
+	}
+	if state, ok := pool.Status(queued.ID()); !ok || state != TaskQueued {
+		t.Fatalf("expect queued task, actual %v", state)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := queued.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expect wait timeout, actual %v", err)
+	}
+	close(release)
+	if data, err := queued.Result(); err != nil || data != "queued" {
+		t.Fatalf("expect result of task, actual %v %v", data, err)
+	}
+	status, err := failed.Wait(context.Background())
+	if err != nil || status.State != TaskFailed || status.Err == nil {
+		t.Fatalf("expect failed task, actual %+v", status)
+	}
+	if state, _ := pool.Status(blocker.ID()); state != TaskSucceeded {
+		t.Fatalf("expect succeeded task, actual %v", state)
+	}
+	if _, ok := pool.Lookup("unknown"); ok {
+		t.Fatalf("expect unknown task not found")
+	}
+	pool.Shutdown()
+}
+
+type contextTask struct {
+	name    string
+	started chan struct{}
+}
+
+func (m *contextTask) RunContext(ctx context.Context, id int) (interface{}, error) {
+	if m.started != nil {
+		close(m.started)
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (m *contextTask) GetName() string {
+	return m.name
+}
+
+type panicTask struct{}
+
+func (m *panicTask) Run(id int) (interface{}, error) {
+	panic("boom")
+}
+
+func (m *panicTask) GetName() string {
+	return "panic"
+}
+
+func TestPoolCancel(t *testing.T) {
+	logger := log.NewLogger(false)
+	pool := NewWithOptions(Options{Name: "cancel", MinRoutines: 1, MaxRoutines: 1}, logger)
+	started := make(chan struct{})
+	running, _ := pool.SubmitContext(&contextTask{name: "running", started: started})
+	queued, _ := pool.SubmitContext(&contextTask{name: "queued"})
+	<-started
+	if !pool.Cancel(queued.ID()) {
+		t.Fatalf("expect queued task cancelled")
+	}
+	if !pool.Cancel(running.ID()) {
+		t.Fatalf("expect running task cancelled")
+	}
+	for _, f := range []*Future{queued, running} {
+		status, _ := f.Wait(context.Background())
+		if status.State != TaskCancelled || status.Err != ErrTaskCancelled {
+			t.Fatalf("expect task %s cancelled, actual %v %v", status.Name, status.State, status.Err)
+		}
+	}
+	if pool.Cancel(running.ID()) {
+		t.Fatalf("expect done task not cancelled")
+	}
+	timeout, _ := pool.SubmitContext(&contextTask{name: "timeout"}, DispatchOptions{Timeout: 10 * time.Millisecond})
+	if _, err := timeout.Result(); err != context.DeadlineExceeded || timeout.Status() != TaskFailed {
+		t.Fatalf("expect task timeout, actual %v %v", timeout.Status(), err)
+	}
+	// adapted task ignoring context releases the routine on deadline
+	hung, _ := pool.Submit(&recordTask{name: "hung", release: make(chan struct{}), ran: make(chan string)}, DispatchOptions{Timeout: 10 * time.Millisecond})
+	if _, err := hung.Result(); err != context.DeadlineExceeded {
+		t.Fatalf("expect hung task timeout, actual %v", err)
+	}
+	panicked := pool.Dispatch(&panicTask{})
+	_, err := panicked.Result()
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" || panicErr.Stack == "" || panicked.Status() != TaskFailed {
+		t.Fatalf("expect panic recovered into failed task, actual %v", err)
+	}
+	pool.Shutdown()
+}
+
+func TestPoolShutdownGracePeriod(t *testing.T) {
+	logger := log.NewLogger(false)
+	pool := NewWithOptions(Options{Name: "grace", MinRoutines: 1, MaxRoutines: 1, ShutdownGracePeriod: 20 * time.Millisecond}, logger)
+	started := make(chan struct{})
+	running, _ := pool.SubmitContext(&contextTask{name: "running", started: started})
+	queued, _ := pool.SubmitContext(&contextTask{name: "queued"})
+	<-started
+	pool.Shutdown()
+	for _, f := range []*Future{running, queued} {
+		if f.Status() != TaskCancelled {
+			t.Fatalf("expect task cancelled after grace period, actual %v", f.Status())
+		}
+	}
+}
+
+type flakyTask struct {
+	failures int32
+	err      error
+}
+
+func (m *flakyTask) Run(id int) (interface{}, error) {
+	if atomic.AddInt32(&m.failures, -1) >= 0 {
+		return nil, m.err
+	}
+	return "ok", nil
+}
+
+func (m *flakyTask) GetName() string {
+	return "flaky"
+}
+
+func TestPoolRetry(t *testing.T) {
+	logger := log.NewLogger(false)
+	pool := NewWithOptions(Options{Name: "retry", MinRoutines: 1, MaxRoutines: 1, Retry: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}}, logger)
+	recovered := pool.Dispatch(&flakyTask{failures: 2, err: errors.New("temporary")})
+	status, _ := recovered.Wait(context.Background())
+	if status.State != TaskSucceeded || len(status.Attempts) != 3 || status.Attempts[0].Err == nil || status.Attempts[2].Err != nil {
+		t.Fatalf("expect task succeeded on third attempt, actual %v %+v", status.State, status.Attempts)
+	}
+	exhausted := pool.Dispatch(&flakyTask{failures: 5, err: errors.New("temporary")})
+	permanent, _ := pool.Submit(&flakyTask{failures: 1, err: Permanent(errors.New("invalid"))}, DispatchOptions{Retry: &RetryPolicy{MaxAttempts: 5}})
+	if status, _ := exhausted.Wait(context.Background()); status.State != TaskFailed || len(status.Attempts) != 3 {
+		t.Fatalf("expect task failed after 3 attempts, actual %v %d", status.State, len(status.Attempts))
+	}
+	if status, _ := permanent.Wait(context.Background()); status.State != TaskFailed || len(status.Attempts) != 1 {
+		t.Fatalf("expect permanent error not retried, actual %v %d", status.State, len(status.Attempts))
+	}
+	letters := pool.DeadLetters()
+	// permanent task fails first
+	if len(letters) != 2 || letters[0].Status.ID != permanent.ID() || letters[1].Status.ID != exhausted.ID() {
+		t.Fatalf("expect 2 dead letters, actual %+v", letters)
+	}
+	// permanent task fails only once, so it succeeds now
+	again, err := pool.Redispatch(permanent.ID())
+	if err != nil {
+		t.Fatalf("failed to redispatch task %v", err)
+	}
+	if data, err := again.Result(); err != nil || data != "ok" {
+		t.Fatalf("expect redispatched task succeeded, actual %v %v", data, err)
+	}
+	if _, err := pool.Redispatch(permanent.ID()); err != ErrTaskNotFound {
+		t.Fatalf("expect ErrTaskNotFound, actual %v", err)
+	}
+	if len(pool.DeadLetters()) != 1 {
+		t.Fatalf("expect 1 dead letter, actual %d", len(pool.DeadLetters()))
+	}
+	pool.Shutdown()
+}
+
+func TestTypedPool(t *testing.T) {
+	logger := log.NewLogger(false)
+	pool := NewTypedPool(Options{Name: "typed", MinRoutines: 2, MaxRoutines: 2}, func(ctx context.Context, in int) (string, error) {
+		if in < 0 {
+			return "", Permanent(fmt.Errorf("negative input %d", in))
+		}
+		return fmt.Sprintf("#%d", in), nil
+	}, logger)
+	f, err := pool.Submit(7)
+	if err != nil {
+		t.Fatalf("failed to submit input %v", err)
+	}
+	var result string
+	if result, err = f.Result(); err != nil || result != "#7" {
+		t.Fatalf("expect typed result, actual %v %v", result, err)
+	}
+	inputs := make(chan int)
+	go func() {
+		for _, in := range []int{1, 2, -1, 3} {
+			inputs <- in
+		}
+		close(inputs)
+	}()
+	succeeded := map[string]bool{}
+	failed := 0
+	for s := range pool.Stream(context.Background(), inputs) {
+		if s.Err != nil {
+			failed++
+			continue
+		}
+		succeeded[s.Data] = true
+	}
+	if failed != 1 || len(succeeded) != 3 || !succeeded["#1"] || !succeeded["#3"] {
+		t.Fatalf("expect 3 succeeded and 1 failed, actual %v %d", succeeded, failed)
+	}
+	pool.Shutdown()
+	if len(*pool.GetResult()) != 5 {
+		t.Fatalf("expect 5 results, actual %d", len(*pool.GetResult()))
+	}
+}
+
+func TestPoolResults(t *testing.T) {
+	logger := log.NewLogger(false)
+	pool := NewWithOptions(Options{Name: "results", MinRoutines: 2, MaxRoutines: 2, Retention: RetentionPolicy{Mode: RetainLast, Count: 2}}, logger)
+	results := pool.Results(context.Background(), 0)
+	completed, failed := int32(0), int32(0)
+	pool.OnComplete(func(s TaskStatus) { atomic.AddInt32(&completed, 1) })
+	pool.OnError(func(s TaskStatus) {
+		atomic.AddInt32(&failed, 1)
+		panic("hook panic is recovered")
+	})
+	futures := []*Future{}
+	for i := 0; i < 4; i++ {
+		futures = append(futures, pool.Dispatch(&recordTask{name: fmt.Sprintf("task-%d", i), ran: make(chan string, 1)}))
+	}
+	futures = append(futures, pool.Dispatch(&failTask{}))
+	for i := 0; i < 5; i++ {
+		if s := <-results; s.ID == "" {
+			t.Fatalf("expect status of done task")
+		}
+	}
+	if len(*pool.GetResult()) != 2 {
+		t.Fatalf("expect last 2 results kept, actual %d", len(*pool.GetResult()))
+	}
+	kept := 0
+	for _, f := range futures {
+		if _, ok := pool.Lookup(f.ID()); ok {
+			kept++
+		}
+	}
+	if kept != 2 {
+		t.Fatalf("expect futures of 2 results kept, actual %d", kept)
+	}
+	pool.Shutdown()
+	if _, ok := <-results; ok {
+		t.Fatalf("expect results closed on shutdown")
+	}
+	if atomic.LoadInt32(&completed) != 5 || atomic.LoadInt32(&failed) != 1 {
+		t.Fatalf("expect 5 completed and 1 failed, actual %d %d", completed, failed)
+	}
+}
+
+func TestPoolAbandonedResults(t *testing.T) {
+	logger := log.NewLogger(false)
+	pool := NewWithOptions(Options{Name: "abandoned", MinRoutines: 2, MaxRoutines: 2}, logger)
+	abandoned := pool.Results(context.Background(), 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := pool.Results(ctx, 1)
+	cancel()
+	if _, ok := <-cancelled; ok {
+		t.Fatalf("expect results closed when ctx is done")
+	}
+	for i := 0; i < 10; i++ {
+		pool.Dispatch(&recordTask{name: fmt.Sprintf("task-%d", i), ran: make(chan string, 1)})
+	}
+	done := make(chan struct{})
+	go func() {
+		pool.Shutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expect pool not blocked by abandoned subscriber")
+	}
+	if dropped, ok := pool.metrics.Get("results_dropped").(*expvar.Int); !ok || dropped.Value() != 9 {
+		t.Fatalf("expect 9 results dropped, actual %v", pool.metrics.Get("results_dropped"))
+	}
+	if n := len(abandoned); n != 1 {
+		t.Fatalf("expect buffered result kept, actual %d", n)
+	}
+}
+
+func TestPoolRetention(t *testing.T) {
+	logger := log.NewLogger(false)
+	none := NewWithOptions(Options{Name: "none", Retention: RetentionPolicy{Mode: RetainNone}}, logger)
+	f := none.Dispatch(&recordTask{name: "none", ran: make(chan string, 1)})
+	none.Shutdown()
+	if _, ok := none.Lookup(f.ID()); ok || len(*none.GetResult()) != 0 {
+		t.Fatalf("expect no result kept")
+	}
+	expiring := NewWithOptions(Options{Name: "duration", Retention: RetentionPolicy{Mode: RetainDuration, Duration: 20 * time.Millisecond}}, logger)
+	expiring.Dispatch(&recordTask{name: "duration", ran: make(chan string, 1)})
+	expiring.Shutdown()
+	if len(*expiring.GetResult()) != 1 {
+		t.Fatalf("expect result kept for duration")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if len(*expiring.GetResult()) != 0 {
+		t.Fatalf("expect result evicted after duration")
+	}
+}
+
+func TestPoolShutdownModes(t *testing.T) {
+	logger := log.NewLogger(false)
+	graceful := NewWithOptions(Options{Name: "graceful", MinRoutines: 1, MaxRoutines: 1}, logger)
+	release := make(chan struct{})
+	ran := make(chan string, 10)
+	running := graceful.Dispatch(&recordTask{name: "running", release: release, ran: ran})
+	for running.Status() != TaskRunning {
+		time.Sleep(time.Millisecond)
+	}
+	queued := graceful.Dispatch(&recordTask{name: "queued", ran: ran})
+	graceful.Dispatch(&recordTask{name: "queued-2", ran: ran})
+	time.AfterFunc(10*time.Millisecond, func() { close(release) })
+	summary := graceful.ShutdownWithOptions(ShutdownOptions{Mode: ShutdownGraceful})
+	if summary.Succeeded != 1 || summary.Cancelled != 2 || len(summary.Unstarted) != 2 || summary.Unstarted[0].GetName() != "queued" {
+		t.Fatalf("expect running task finished and queued tasks returned, actual %+v", summary)
+	}
+	if queued.Status() != TaskCancelled {
+		t.Fatalf("expect unstarted task cancelled, actual %v", queued.Status())
+	}
+	if again := graceful.Shutdown(); again.Mode != ShutdownGraceful || again.Succeeded != 1 {
+		t.Fatalf("expect shutdown idempotent, actual %+v", again)
+	}
+
+	immediate := NewWithOptions(Options{Name: "immediate", MinRoutines: 1, MaxRoutines: 1}, logger)
+	started := make(chan struct{})
+	immediate.SubmitContext(&contextTask{name: "running", started: started})
+	immediate.Dispatch(&recordTask{name: "hung", release: make(chan struct{}), ran: ran})
+	<-started
+	summary = immediate.ShutdownWithOptions(ShutdownOptions{Mode: ShutdownImmediate})
+	if summary.Cancelled != 2 || summary.Succeeded != 0 || len(summary.Unstarted) != 0 {
+		t.Fatalf("expect all tasks cancelled, actual %+v", summary)
+	}
+
+	// adapted task ignoring context is abandoned once drain timeout is passed
+	drain := NewWithOptions(Options{Name: "drain", MinRoutines: 1, MaxRoutines: 1}, logger)
+	hung := drain.Dispatch(&recordTask{name: "hung", release: make(chan struct{}), ran: ran})
+	for hung.Status() != TaskRunning {
+		time.Sleep(time.Millisecond)
+	}
+	summary = drain.ShutdownWithOptions(ShutdownOptions{Timeout: 10 * time.Millisecond})
+	if summary.Mode != ShutdownDrain || summary.Abandoned != 1 || summary.Cancelled != 1 {
+		t.Fatalf("expect hung task abandoned, actual %+v", summary)
+	}
+	if _, err := drain.TryDispatch(&recordTask{name: "late", ran: ran}); err != ErrShuttingDown {
+		t.Fatalf("expect ErrShuttingDown, actual %v", err)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	logger := log.NewLogger(false)
+	pool := NewWithOptions(Options{Name: "stats", MinRoutines: 1, MaxRoutines: 1}, logger)
+	release := make(chan struct{})
+	ran := make(chan string, 20)
+	blocker := pool.Dispatch(&recordTask{name: "blocker", release: release, ran: ran})
+	for blocker.Status() != TaskRunning {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 9; i++ {
+		pool.Dispatch(&recordTask{name: "record", ran: ran})
+	}
+	pool.Dispatch(&failTask{})
+	if s := pool.Stats(); s.Queued != 10 || s.Running != 1 {
+		t.Fatalf("expect 10 queued and 1 running, actual %d %d", s.Queued, s.Running)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	m := poolMetrics.Get("stats").(*expvar.Map)
+	pool.Shutdown()
+	s := pool.Stats()
+	if s.Completed != 11 || s.Succeeded != 10 || s.Failed != 1 || s.FailureRate != 1.0/11 {
+		t.Fatalf("expect 10 succeeded and 1 failed, actual %+v", s.TaskStats)
+	}
+	if s.Wait.P50 < 20*time.Millisecond || s.Run.P99 < 20*time.Millisecond || s.Run.P50 > s.Run.P99 {
+		t.Fatalf("expect latencies of queued tasks and blocker, actual %+v %+v", s.Wait, s.Run)
+	}
+	if s.Throughput["1m"] != 11.0/60 {
+		t.Fatalf("expect throughput of 11 tasks in 1m, actual %v", s.Throughput)
+	}
+	if r := s.Tasks["record"]; r.Completed != 9 || r.SuccessRate != 1 || s.Tasks["fail"].Failed != 1 {
+		t.Fatalf("expect stats by task name, actual %+v", s.Tasks)
+	}
+	var exported Stats
+	if err := json.Unmarshal([]byte(m.Get("stats").String()), &exported); err != nil || exported.Completed != 11 {
+		t.Fatalf("expect stats exported to expvar, actual %+v %v", exported, err)
+	}
+	if poolMetrics.Get("stats") != nil {
+		t.Fatalf("expect metrics removed on shutdown")
+	}
+}
+
+func TestPoolMetricsNames(t *testing.T) {
+	logger := log.NewLogger(false)
+	a := New(1, 1, 0, logger)
+	b := New(1, 1, 0, logger)
+	if a.metricsName == b.metricsName || poolMetrics.Get(a.metricsName) == nil || poolMetrics.Get(b.metricsName) == nil {
+		t.Fatalf("expect unique metrics of unnamed pools, actual %s and %s", a.metricsName, b.metricsName)
+	}
+	a.Shutdown()
+	b.Shutdown()
+	if poolMetrics.Get(a.metricsName) != nil || poolMetrics.Get(b.metricsName) != nil {
+		t.Fatalf("expect metrics removed on shutdown")
+	}
+}
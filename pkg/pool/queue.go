@@ -0,0 +1,206 @@
+package pool
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// OverflowBlock Dispatch blocks until the queue has room
+	OverflowBlock = "block"
+	// OverflowReject Dispatch fails with ErrQueueFull
+	OverflowReject = "reject"
+	// OverflowDropOldest the oldest task of the lowest priority is dropped to make room
+	OverflowDropOldest = "drop-oldest"
+)
+
+// pushMode how push behaves when the queue is full
+type pushMode int
+
+const (
+	// pushOverflow apply overflow policy, wait for room if it is block
+	pushOverflow pushMode = iota
+	// pushNoWait apply overflow policy but never wait
+	pushNoWait
+	// pushBlock wait for room whatever overflow policy is, tasks are never rejected or dropped
+	pushBlock
+)
+
+var ErrQueueFull = errors.New("task queue is full")
+var ErrShuttingDown = errors.New("pool is shutting down")
+var ErrTaskDropped = errors.New("task is dropped from full queue")
+
+type queueItem[Out any] struct {
+	task     internalTask[Out]
+	priority int
+	sequence uint64
+	index    int
+}
+
+// taskHeap tasks of higher priority first, then in dispatch order
+type taskHeap[Out any] []*queueItem[Out]
+
+func (h taskHeap[Out]) Len() int { return len(h) }
+
+func (h taskHeap[Out]) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].sequence < h[j].sequence
+}
+
+func (h taskHeap[Out]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *taskHeap[Out]) Push(x interface{}) {
+	item := x.(*queueItem[Out])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *taskHeap[Out]) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// taskQueue bounded priority queue between Dispatch and workers
+type taskQueue[Out any] struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	items    taskHeap[Out]
+	capacity int
+	overflow string
+	sequence uint64
+	closed   bool
+}
+
+// newTaskQueue create queue, capacity 0 means unbounded
+func newTaskQueue[Out any](capacity int, overflow string) *taskQueue[Out] {
+	if overflow == "" {
+		overflow = OverflowBlock
+	}
+	q := taskQueue[Out]{capacity: capacity, overflow: overflow}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	return &q
+}
+
+// push queue task, the full queue is handled by mode. The dropped task is returned for drop-oldest.
+func (q *taskQueue[Out]) push(t internalTask[Out], priority int, mode pushMode) (*internalTask[Out], error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var dropped *internalTask[Out]
+	for !q.closed && q.full() {
+		if mode == pushBlock {
+			q.notFull.Wait()
+			continue
+		}
+		if q.overflow == OverflowDropOldest {
+			dropped = q.dropOldest()
+			break
+		}
+		if q.overflow == OverflowReject || mode == pushNoWait {
+			return nil, ErrQueueFull
+		}
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return nil, ErrShuttingDown
+	}
+	q.sequence++
+	heap.Push(&q.items, &queueItem[Out]{task: t, priority: priority, sequence: q.sequence})
+	q.notEmpty.Signal()
+	return dropped, nil
+}
+
+// pop take the next task, wait until a task is queued.
+// ok is false when the queue is closed and empty, or retire returns true while the queue is empty.
+func (q *taskQueue[Out]) pop(retire func() bool) (internalTask[Out], bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 {
+		if q.closed || retire() {
+			return internalTask[Out]{}, false
+		}
+		q.notEmpty.Wait()
+	}
+	item := heap.Pop(&q.items).(*queueItem[Out])
+	q.notFull.Signal()
+	return item.task, true
+}
+
+// close reject new tasks, queued tasks can still be taken
+func (q *taskQueue[Out]) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// wake wake up waiting routines, e.g. for them to retire
+func (q *taskQueue[Out]) wake() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.notEmpty.Broadcast()
+}
+
+// oldestWait how long the oldest queued task has waited
+func (q *taskQueue[Out]) oldestWait(now time.Time) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var oldest *queueItem[Out]
+	for _, item := range q.items {
+		if oldest == nil || item.sequence < oldest.sequence {
+			oldest = item
+		}
+	}
+	if oldest == nil {
+		return 0
+	}
+	return now.Sub(oldest.task.AssignTime)
+}
+
+// drain remove all queued tasks, in the order they would run
+func (q *taskQueue[Out]) drain() []internalTask[Out] {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tasks := make([]internalTask[Out], 0, len(q.items))
+	for len(q.items) > 0 {
+		tasks = append(tasks, heap.Pop(&q.items).(*queueItem[Out]).task)
+	}
+	q.notFull.Broadcast()
+	return tasks
+}
+
+func (q *taskQueue[Out]) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+func (q *taskQueue[Out]) full() bool {
+	return q.capacity > 0 && len(q.items) >= q.capacity
+}
+
+// dropOldest remove the oldest task of the lowest priority
+func (q *taskQueue[Out]) dropOldest() *internalTask[Out] {
+	var victim *queueItem[Out]
+	for _, item := range q.items {
+		if victim == nil || item.priority < victim.priority || item.priority == victim.priority && item.sequence < victim.sequence {
+			victim = item
+		}
+	}
+	heap.Remove(&q.items, victim.index)
+	return &victim.task
+}
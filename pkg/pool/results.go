@@ -0,0 +1,184 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// RetainAll all results are kept, long running pools grow without bound in this mode
+	RetainAll = "all"
+	// RetainLast the last Count results are kept
+	RetainLast = "last"
+	// RetainDuration results are kept for Duration after completion
+	RetainDuration = "duration"
+	// RetainNone results are not kept, use Results or hooks to consume them
+	RetainNone = "none"
+)
+
+// RetentionPolicy which results of done tasks are kept for GetResult and Lookup
+type RetentionPolicy struct {
+	// Mode all, last, duration or none, default last
+	Mode string `json:"mode" yaml:"mode"`
+	// Count number of results kept in last mode, default 10000
+	Count int `json:"count" yaml:"count"`
+	// Duration how long results are kept in duration mode
+	Duration time.Duration `json:"duration" yaml:"duration"`
+}
+
+const (
+	defaultRetainCount   = 10000
+	defaultResultsBuffer = 64
+)
+
+type subscriber[Out any] struct {
+	results chan TypedStatus[Out]
+	stop    func() bool
+}
+
+// Results channel of task statuses completed from now on, it is closed when ctx is done or the pool is shut down.
+// Results are delivered in order of completion without waiting for readers, statuses are dropped and counted
+// as results_dropped in metrics while buffer of the channel is full, buffer is 64 if not positive.
+func (p *engine[Out]) Results(ctx context.Context, buffer int) <-chan TypedStatus[Out] {
+	if buffer <= 0 {
+		buffer = defaultResultsBuffer
+	}
+	s := &subscriber[Out]{results: make(chan TypedStatus[Out], buffer)}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resultsClosed {
+		close(s.results)
+		return s.results
+	}
+	p.subscribers = append(p.subscribers, s)
+	s.stop = context.AfterFunc(ctx, func() {
+		p.unsubscribe(s)
+	})
+	return s.results
+}
+
+// unsubscribe remove subscriber and close its channel
+func (p *engine[Out]) unsubscribe(s *subscriber[Out]) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, sub := range p.subscribers {
+		if sub == s {
+			p.subscribers = append(p.subscribers[:i:i], p.subscribers[i+1:]...)
+			close(s.results)
+			return
+		}
+	}
+}
+
+// OnComplete register hook called with the status of every done task, hooks are called one at a time in order of completion
+func (p *engine[Out]) OnComplete(hook func(status TypedStatus[Out])) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onComplete = append(p.onComplete, hook)
+}
+
+// OnError register hook called with the status of every task done with error, including cancelled and dropped tasks
+func (p *engine[Out]) OnError(hook func(status TypedStatus[Out])) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onError = append(p.onError, hook)
+}
+
+// deliver keep status by retention policy, call hooks and send it to subscribers, called by result routine
+func (p *engine[Out]) deliver(s TypedStatus[Out]) {
+	switch s.State {
+	case TaskSucceeded:
+		atomic.AddInt64(&p.succeeded, 1)
+	case TaskFailed:
+		atomic.AddInt64(&p.failed, 1)
+	default:
+		atomic.AddInt64(&p.cancelled, 1)
+	}
+	p.stats.record(s.Name, s.State, s.AssignTime, s.StartTime, s.Duration, time.Now())
+	p.mu.Lock()
+	p.retain(s)
+	hooks := append([]func(TypedStatus[Out]){}, p.onComplete...)
+	if s.Err != nil {
+		hooks = append(hooks, p.onError...)
+	}
+	for _, sub := range p.subscribers {
+		select {
+		case sub.results <- s:
+		default:
+			p.metrics.Add("results_dropped", 1)
+		}
+	}
+	p.mu.Unlock()
+	for _, hook := range hooks {
+		p.callHook(hook, s)
+	}
+}
+
+// callHook call hook, a panic in hook is logged
+func (p *engine[Out]) callHook(hook func(TypedStatus[Out]), s TypedStatus[Out]) {
+	defer func() {
+		if err := recover(); err != nil {
+			p.logger.Error(fmt.Errorf("%v", err), "task hook panicked", "task", s.ID, "stack", string(debug.Stack()))
+		}
+	}()
+	hook(s)
+}
+
+// closeResults close channels of subscribers, called by result routine on shutdown
+func (p *engine[Out]) closeResults() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resultsClosed = true
+	for _, sub := range p.subscribers {
+		sub.stop()
+		close(sub.results)
+	}
+	p.subscribers = nil
+}
+
+// retain keep status by retention policy, futures of dropped results can no longer be looked up. The lock must be held.
+func (p *engine[Out]) retain(s TypedStatus[Out]) {
+	policy := p.options.Retention
+	if policy.Mode == RetainNone {
+		delete(p.futures, s.ID)
+		return
+	}
+	p.tasksStatus = append(p.tasksStatus, s)
+	p.evict(time.Now())
+}
+
+// evict drop results outside of retention policy. The lock must be held.
+func (p *engine[Out]) evict(now time.Time) {
+	policy := p.options.Retention
+	n := 0
+	switch policy.Mode {
+	case RetainLast:
+		count := policy.Count
+		if count <= 0 {
+			count = defaultRetainCount
+		}
+		n = max(len(p.tasksStatus)-count, 0)
+	case RetainDuration:
+		for n < len(p.tasksStatus) && now.Sub(doneTime(p.tasksStatus[n])) > policy.Duration {
+			n++
+		}
+	}
+	if n == 0 {
+		return
+	}
+	for _, s := range p.tasksStatus[:n] {
+		delete(p.futures, s.ID)
+	}
+	p.tasksStatus = append(p.tasksStatus[:0:0], p.tasksStatus[n:]...)
+}
+
+// doneTime when task is done
+func doneTime[Out any](s TypedStatus[Out]) time.Time {
+	if s.StartTime.IsZero() {
+		return s.AssignTime.Add(s.Duration)
+	}
+	return s.StartTime.Add(s.Duration)
+}
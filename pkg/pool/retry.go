@@ -0,0 +1,142 @@
+package pool
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = time.Second
+	defaultRetryMaxBackoff     = 30 * time.Second
+	defaultRetryMultiplier     = 2
+)
+
+// RetryPolicy how failed tasks are retried
+type RetryPolicy struct {
+	// MaxAttempts attempts including the first run, default 3
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+	// InitialBackoff wait before the first retry, default 1s
+	InitialBackoff time.Duration `json:"initialBackoff" yaml:"initialBackoff"`
+	// MaxBackoff limit of wait between retries, default 30s
+	MaxBackoff time.Duration `json:"maxBackoff" yaml:"maxBackoff"`
+	// Multiplier backoff is multiplied after every retry, default 2
+	Multiplier float64 `json:"multiplier" yaml:"multiplier"`
+	// Retryable whether error of task is worth a retry, default all errors but permanent and cancelled ones
+	Retryable func(err error) bool `json:"-" yaml:"-"`
+}
+
+// withDefaults copy of policy with defaults
+func (r RetryPolicy) withDefaults() *RetryPolicy {
+	if r.MaxAttempts <= 0 {
+		r.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if r.MaxBackoff < r.InitialBackoff {
+		r.MaxBackoff = max(defaultRetryMaxBackoff, r.InitialBackoff)
+	}
+	if r.Multiplier < 1 {
+		r.Multiplier = defaultRetryMultiplier
+	}
+	if r.Retryable == nil {
+		r.Retryable = IsRetryable
+	}
+	return &r
+}
+
+// backoff wait before the next attempt, attempt is the number of the failed attempt
+func (r *RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := float64(r.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= r.Multiplier
+		if backoff >= float64(r.MaxBackoff) {
+			return r.MaxBackoff
+		}
+	}
+	return time.Duration(backoff)
+}
+
+// PermanentError error of task which is never retried
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent mark err as not retryable
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsRetryable default classifier, errors are retryable unless they are permanent or the task is cancelled or dropped
+func IsRetryable(err error) bool {
+	var permanent *PermanentError
+	return !errors.As(err, &permanent) && !errors.Is(err, ErrTaskCancelled) && !errors.Is(err, ErrTaskDropped)
+}
+
+// TaskAttempt one run of a task
+type TaskAttempt struct {
+	Attempt   int
+	Executor  string
+	StartTime time.Time
+	Duration  time.Duration
+	Err       error
+}
+
+// DeadLetter failed task with retry policy, it can be inspected and re-dispatched
+type DeadLetter = TypedDeadLetter[interface{}]
+
+// TypedDeadLetter failed task with result of type Out
+type TypedDeadLetter[Out any] struct {
+	Task    TypedTask[Out]
+	Status  TypedStatus[Out]
+	Options DispatchOptions
+}
+
+// DeadLetters failed tasks with retry policy, oldest first
+func (p *engine[Out]) DeadLetters() []TypedDeadLetter[Out] {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	result := make([]TypedDeadLetter[Out], len(p.deadLetters))
+	copy(result, p.deadLetters)
+	return result
+}
+
+// Redispatch remove task of id from dead letters and submit it again with its options
+func (p *engine[Out]) Redispatch(id string) (*TypedFuture[Out], error) {
+	p.mu.Lock()
+	var letter *TypedDeadLetter[Out]
+	for i := range p.deadLetters {
+		if p.deadLetters[i].Status.ID == id {
+			l := p.deadLetters[i]
+			letter = &l
+			p.deadLetters = append(p.deadLetters[:i], p.deadLetters[i+1:]...)
+			break
+		}
+	}
+	p.mu.Unlock()
+	if letter == nil {
+		return nil, ErrTaskNotFound
+	}
+	f, err := p.SubmitTask(letter.Task, letter.Options)
+	if err != nil {
+		// keep it for another try
+		p.mu.Lock()
+		p.deadLetters = append(p.deadLetters, *letter)
+		p.mu.Unlock()
+		return nil, err
+	}
+	p.logger.Info("dead letter is dispatched again", "task", id, "newTask", f.ID())
+	return f, nil
+}
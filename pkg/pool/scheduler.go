@@ -0,0 +1,345 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// OverlapSkip a run is skipped while the previous run is not done
+	OverlapSkip = "skip"
+	// OverlapQueue a run waits until the previous run is done
+	OverlapQueue = "queue"
+	// OverlapAllow runs are dispatched regardless of previous runs
+	OverlapAllow = "allow"
+
+	// MisfireSkip runs missed while paused are skipped
+	MisfireSkip = "skip"
+	// MisfireRunOnce runs missed while paused are run once on resume
+	MisfireRunOnce = "run-once"
+	// MisfireRunAll every run missed while paused is run on resume, at most maxMisfireRuns
+	MisfireRunAll = "run-all"
+
+	maxMisfireRuns = 100
+)
+
+var ErrScheduleNotFound = errors.New("schedule is not found")
+var ErrScheduleExists = errors.New("schedule already exists")
+
+// ScheduleOptions when and how a task is dispatched, one of At, Delay and Cron is required
+type ScheduleOptions struct {
+	// Name unique name of schedule, generated if empty
+	Name string `json:"name" yaml:"name"`
+	// At run once at the time
+	At time.Time `json:"at" yaml:"at"`
+	// Delay run once after the delay
+	Delay time.Duration `json:"delay" yaml:"delay"`
+	// Cron run on cron expression with seconds, see ParseCron
+	Cron string `json:"cron" yaml:"cron"`
+	// TimeZone IANA time zone of Cron, default local
+	TimeZone string `json:"timeZone" yaml:"timeZone"`
+	// Jitter random delay up to Jitter added to every run
+	Jitter time.Duration `json:"jitter" yaml:"jitter"`
+	// Overlap skip, queue or allow, default skip
+	Overlap string `json:"overlap" yaml:"overlap"`
+	// Misfire skip, run-once or run-all for runs missed while paused, default run-once
+	Misfire string `json:"misfire" yaml:"misfire"`
+	// Dispatch options of dispatched tasks
+	Dispatch DispatchOptions `json:"-" yaml:"-"`
+}
+
+// ScheduleInfo state of a schedule
+type ScheduleInfo struct {
+	Name    string
+	Spec    string
+	Paused  bool
+	Next    time.Time
+	LastRun time.Time
+	Runs    int64
+	Skipped int64
+}
+
+// Scheduler dispatch tasks into pool at a time, after a delay or on cron schedule
+type Scheduler struct {
+	pool      *Pool
+	logger    *logr.Logger
+	mu        sync.Mutex
+	schedules map[string]*scheduledTask
+	sequence  int
+	stopped   bool
+}
+
+// NewScheduler create new scheduler dispatching tasks into pool
+func NewScheduler(pool *Pool, logger *logr.Logger) *Scheduler {
+	return &Scheduler{pool: pool, logger: logger, schedules: map[string]*scheduledTask{}}
+}
+
+type scheduledTask struct {
+	scheduler *Scheduler
+	task      Task
+	options   ScheduleOptions
+	spec      string
+	schedule  Schedule
+	wake      chan struct{}
+	done      chan struct{}
+	mu        sync.Mutex
+	info      ScheduleInfo
+	last      *Future
+}
+
+// Add schedule task, the name of schedule is returned
+func (s *Scheduler) Add(task Task, options ScheduleOptions) (string, error) {
+	schedule, spec, err := buildSchedule(options)
+	if err != nil {
+		return "", err
+	}
+	if options.Overlap == "" {
+		options.Overlap = OverlapSkip
+	}
+	if options.Misfire == "" {
+		options.Misfire = MisfireRunOnce
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return "", ErrShuttingDown
+	}
+	if options.Name == "" {
+		s.sequence++
+		options.Name = fmt.Sprintf("%s-%d", task.GetName(), s.sequence)
+	}
+	if _, ok := s.schedules[options.Name]; ok {
+		return "", ErrScheduleExists
+	}
+	st := &scheduledTask{scheduler: s, task: task, options: options, spec: spec, schedule: schedule,
+		wake: make(chan struct{}, 1), done: make(chan struct{}), info: ScheduleInfo{Name: options.Name, Spec: spec}}
+	s.schedules[options.Name] = st
+	go st.loop()
+	s.logger.Info("task is scheduled", "schedule", options.Name, "task", task.GetName(), "spec", spec)
+	return options.Name, nil
+}
+
+func buildSchedule(options ScheduleOptions) (Schedule, string, error) {
+	switch {
+	case options.Cron != "":
+		location := time.Local
+		if options.TimeZone != "" {
+			l, err := time.LoadLocation(options.TimeZone)
+			if err != nil {
+				return nil, "", err
+			}
+			location = l
+		}
+		schedule, err := ParseCron(options.Cron, location)
+		return schedule, options.Cron, err
+	case !options.At.IsZero():
+		return onceSchedule(options.At), "at " + options.At.Format(time.RFC3339), nil
+	case options.Delay > 0:
+		at := time.Now().Add(options.Delay)
+		return onceSchedule(at), "after " + options.Delay.String(), nil
+	}
+	return nil, "", fmt.Errorf("schedule requires at, delay or cron")
+}
+
+// List state of schedules, ordered by name
+func (s *Scheduler) List() []ScheduleInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]ScheduleInfo, 0, len(s.schedules))
+	for _, st := range s.schedules {
+		st.mu.Lock()
+		result = append(result, st.info)
+		st.mu.Unlock()
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Pause stop dispatching runs of schedule until it is resumed
+func (s *Scheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+// Resume resume paused schedule, runs missed meanwhile are handled by its misfire policy
+func (s *Scheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	s.mu.Lock()
+	st, ok := s.schedules[name]
+	s.mu.Unlock()
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	st.mu.Lock()
+	st.info.Paused = paused
+	st.mu.Unlock()
+	select {
+	case st.wake <- struct{}{}:
+	default:
+	}
+	s.logger.Info("schedule is updated", "schedule", name, "paused", paused)
+	return nil
+}
+
+// Remove remove schedule, dispatched runs are not cancelled
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.schedules[name]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	delete(s.schedules, name)
+	close(st.done)
+	s.logger.Info("schedule is removed", "schedule", name)
+	return nil
+}
+
+// Stop remove all schedules, new schedules are rejected
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	for name, st := range s.schedules {
+		delete(s.schedules, name)
+		close(st.done)
+	}
+}
+
+// loop wait for next run of schedule and dispatch task
+func (st *scheduledTask) loop() {
+	next := st.schedule.Next(time.Now())
+	for {
+		if next.IsZero() {
+			st.finish()
+			return
+		}
+		fire := next
+		if st.options.Jitter > 0 {
+			fire = fire.Add(time.Duration(rand.Int63n(int64(st.options.Jitter))))
+		}
+		st.mu.Lock()
+		st.info.Next = fire
+		st.mu.Unlock()
+		timer := time.NewTimer(time.Until(fire))
+		select {
+		case <-st.done:
+			timer.Stop()
+			return
+		case <-st.wake:
+			timer.Stop()
+		case <-timer.C:
+			if !st.paused() {
+				st.run()
+				next = st.schedule.Next(next)
+				continue
+			}
+		}
+		if st.paused() {
+			if !st.waitResume() {
+				return
+			}
+			next = st.misfire(next)
+		}
+	}
+}
+
+func (st *scheduledTask) paused() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.info.Paused
+}
+
+// waitResume wait until schedule is resumed, false is returned if it is removed
+func (st *scheduledTask) waitResume() bool {
+	for st.paused() {
+		select {
+		case <-st.done:
+			return false
+		case <-st.wake:
+		}
+	}
+	return true
+}
+
+// misfire handle runs missed since next by misfire policy, the next run after now is returned
+func (st *scheduledTask) misfire(next time.Time) time.Time {
+	now := time.Now()
+	missed := 0
+	for !next.IsZero() && !next.After(now) {
+		missed++
+		if missed >= maxMisfireRuns {
+			next = st.schedule.Next(now)
+			break
+		}
+		next = st.schedule.Next(next)
+	}
+	if missed == 0 {
+		return next
+	}
+	st.scheduler.logger.Info("schedule missed runs while paused", "schedule", st.info.Name, "missed", missed, "policy", st.options.Misfire)
+	switch st.options.Misfire {
+	case MisfireRunAll:
+		for i := 0; i < missed; i++ {
+			st.run()
+		}
+	case MisfireRunOnce:
+		st.run()
+	default:
+		st.mu.Lock()
+		st.info.Skipped += int64(missed)
+		st.mu.Unlock()
+	}
+	return next
+}
+
+// run dispatch task by overlap policy
+func (st *scheduledTask) run() {
+	if st.last != nil {
+		switch st.options.Overlap {
+		case OverlapSkip:
+			if !st.last.Status().Done() {
+				st.scheduler.logger.Info("previous run is not done, skip run", "schedule", st.info.Name)
+				st.mu.Lock()
+				st.info.Skipped++
+				st.mu.Unlock()
+				return
+			}
+		case OverlapQueue:
+			select {
+			case <-st.last.Done():
+			case <-st.done:
+				return
+			}
+		}
+	}
+	f, err := st.scheduler.pool.Submit(st.task, st.options.Dispatch)
+	if err != nil {
+		st.scheduler.logger.Error(err, "failed to dispatch scheduled task", "schedule", st.info.Name)
+		return
+	}
+	st.last = f
+	st.mu.Lock()
+	st.info.Runs++
+	st.info.LastRun = time.Now()
+	st.mu.Unlock()
+}
+
+// finish remove schedule without further runs
+func (st *scheduledTask) finish() {
+	s := st.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.schedules[st.info.Name] == st {
+		delete(s.schedules, st.info.Name)
+		s.logger.Info("schedule is finished", "schedule", st.info.Name)
+	}
+}
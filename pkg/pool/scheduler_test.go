@@ -0,0 +1,113 @@
+package pool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/af-go/peach-common/pkg/log"
+)
+
+func TestParseCron(t *testing.T) {
+	utc := time.UTC
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone database %v", err)
+	}
+	cases := []struct {
+		spec     string
+		location *time.Location
+		from     string
+		expect   string
+	}{
+		{"* * * * * *", utc, "2024-01-01T00:00:00Z", "2024-01-01T00:00:01Z"},
+		{"*/15 * * * * *", utc, "2024-01-01T00:00:16Z", "2024-01-01T00:00:30Z"},
+		{"0 30 9-17 * * MON-FRI", utc, "2024-01-05T17:30:00Z", "2024-01-08T09:30:00Z"},
+		{"0 0 0 29 FEB ?", utc, "2024-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"0 0 12 1 * 7", utc, "2024-01-01T12:00:00Z", "2024-01-07T12:00:00Z"},
+		{"@daily", utc, "2024-01-31T10:00:00Z", "2024-02-01T00:00:00Z"},
+		{"0 0 9 * * *", berlin, "2024-07-01T08:00:00Z", "2024-07-02T07:00:00Z"},
+		{"@every 90s", utc, "2024-01-01T00:00:00Z", "2024-01-01T00:01:30Z"},
+	}
+	for _, c := range cases {
+		schedule, err := ParseCron(c.spec, c.location)
+		if err != nil {
+			t.Fatalf("failed to parse %s %v", c.spec, err)
+		}
+		from, _ := time.Parse(time.RFC3339, c.from)
+		expect, _ := time.Parse(time.RFC3339, c.expect)
+		if next := schedule.Next(from); !next.Equal(expect) {
+			t.Fatalf("expect next of %s after %s %s, actual %s", c.spec, c.from, c.expect, next)
+		}
+	}
+	for _, spec := range []string{"* * * * *", "60 * * * * *", "* * * * 13 *", "*/0 * * * * *", "5-1 * * * * *", "@every x"} {
+		if _, err := ParseCron(spec, utc); err == nil {
+			t.Fatalf("expect invalid cron %s", spec)
+		}
+	}
+}
+
+type countTask struct {
+	runs  int32
+	sleep time.Duration
+}
+
+func (m *countTask) Run(id int) (interface{}, error) {
+	atomic.AddInt32(&m.runs, 1)
+	time.Sleep(m.sleep)
+	return nil, nil
+}
+
+func (m *countTask) GetName() string {
+	return "count"
+}
+
+func TestScheduler(t *testing.T) {
+	logger := log.NewLogger(false)
+	pool := NewWithOptions(Options{Name: "scheduler", MinRoutines: 2, MaxRoutines: 2}, logger)
+	scheduler := NewScheduler(pool, logger)
+	once := &countTask{}
+	if _, err := scheduler.Add(once, ScheduleOptions{Name: "once", Delay: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("failed to schedule task %v", err)
+	}
+	if _, err := scheduler.Add(once, ScheduleOptions{Name: "once", Delay: time.Second}); err != ErrScheduleExists {
+		t.Fatalf("expect ErrScheduleExists, actual %v", err)
+	}
+	slow := &countTask{sleep: 50 * time.Millisecond}
+	scheduler.Add(slow, ScheduleOptions{Name: "slow", Cron: "@every 10ms"})
+	paused := &countTask{}
+	scheduler.Add(paused, ScheduleOptions{Name: "paused", Cron: "@every 10ms", Misfire: MisfireSkip})
+	if err := scheduler.Pause("paused"); err != nil {
+		t.Fatalf("failed to pause schedule %v", err)
+	}
+	time.Sleep(120 * time.Millisecond)
+	list := scheduler.List()
+	if len(list) != 2 || list[0].Name != "paused" || list[1].Name != "slow" {
+		t.Fatalf("expect one-shot schedule finished, actual %+v", list)
+	}
+	if atomic.LoadInt32(&once.runs) != 1 {
+		t.Fatalf("expect delayed task run once, actual %d", once.runs)
+	}
+	if atomic.LoadInt32(&paused.runs) != 0 || !list[0].Paused {
+		t.Fatalf("expect paused schedule not run, actual %d", paused.runs)
+	}
+	if list[1].Skipped == 0 || atomic.LoadInt32(&slow.runs) > 4 {
+		t.Fatalf("expect overlapping runs skipped, actual %+v", list[1])
+	}
+	scheduler.Resume("paused")
+	time.Sleep(35 * time.Millisecond)
+	if runs := atomic.LoadInt32(&paused.runs); runs == 0 || runs > 4 {
+		t.Fatalf("expect missed runs skipped and schedule resumed, actual %d", runs)
+	}
+	if err := scheduler.Remove("slow"); err != nil {
+		t.Fatalf("failed to remove schedule %v", err)
+	}
+	if err := scheduler.Remove("slow"); err != ErrScheduleNotFound {
+		t.Fatalf("expect ErrScheduleNotFound, actual %v", err)
+	}
+	scheduler.Stop()
+	if len(scheduler.List()) != 0 {
+		t.Fatalf("expect no schedule after stop")
+	}
+	pool.Shutdown()
+}
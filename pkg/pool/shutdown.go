@@ -0,0 +1,131 @@
+package pool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ShutdownDrain queued tasks are run before shutdown returns
+	ShutdownDrain = "drain"
+	// ShutdownGraceful running tasks are finished, queued tasks are returned in the summary
+	ShutdownGraceful = "graceful"
+	// ShutdownImmediate running and queued tasks are cancelled
+	ShutdownImmediate = "immediate"
+)
+
+// ShutdownOptions how the pool is shut down
+type ShutdownOptions struct {
+	// Mode drain, graceful or immediate, default drain
+	Mode string `json:"mode" yaml:"mode"`
+	// Timeout running tasks, and queued tasks in drain mode, are cancelled if shutdown takes longer, 0 means ShutdownGracePeriod of pool
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+}
+
+// ShutdownSummary summary of tasks when the pool is shut down
+type ShutdownSummary = TypedShutdownSummary[interface{}]
+
+// TypedShutdownSummary summary of tasks with result of type Out when the pool is shut down
+type TypedShutdownSummary[Out any] struct {
+	Mode string
+	// Succeeded Failed Cancelled number of tasks done in the lifetime of pool, dropped tasks are cancelled
+	Succeeded int64
+	Failed    int64
+	Cancelled int64
+	// Abandoned number of tasks ignoring their context which were left running
+	Abandoned int64
+	// Unstarted queued tasks of graceful shutdown, in the order they would run
+	Unstarted []TypedTask[Out]
+	Duration  time.Duration
+}
+
+// Shutdown shutdown pool, queued tasks are run before it returns
+func (p *engine[Out]) Shutdown() TypedShutdownSummary[Out] {
+	return p.ShutdownWithOptions(ShutdownOptions{Mode: ShutdownDrain})
+}
+
+// ShutdownWithOptions shutdown pool, new tasks are rejected with ErrShuttingDown.
+// It is safe to call more than once, later calls wait for the first one and return the same summary.
+func (p *engine[Out]) ShutdownWithOptions(options ShutdownOptions) TypedShutdownSummary[Out] {
+	p.shutdownOnce.Do(func() {
+		start := time.Now()
+		if options.Mode == "" {
+			options.Mode = ShutdownDrain
+		}
+		if options.Timeout <= 0 {
+			options.Timeout = p.options.ShutdownGracePeriod
+		}
+		p.shutdownChannel <- options
+		p.wg.Wait()
+		removeMetrics(p.metricsName)
+		p.summary = TypedShutdownSummary[Out]{
+			Mode:      options.Mode,
+			Succeeded: atomic.LoadInt64(&p.succeeded),
+			Failed:    atomic.LoadInt64(&p.failed),
+			Cancelled: atomic.LoadInt64(&p.cancelled),
+			Abandoned: atomic.LoadInt64(&p.abandoned),
+			Unstarted: p.unstarted,
+			Duration:  time.Since(start),
+		}
+		p.logger.Info("pool is shut down", "mode", options.Mode, "succeeded", p.summary.Succeeded, "failed", p.summary.Failed,
+			"cancelled", p.summary.Cancelled, "abandoned", p.summary.Abandoned, "unstarted", len(p.unstarted))
+	})
+	return p.summary
+}
+
+// shutdown stop routines by mode, called by daemon
+func (p *engine[Out]) shutdown(options ShutdownOptions) {
+	p.logger.Info("shutdown signal is received", "mode", options.Mode)
+	p.shuttingDown.Store(true)
+	close(p.stopped)
+	// routines stop when the queue is empty
+	p.queue.close()
+	switch options.Mode {
+	case ShutdownGraceful:
+		for _, t := range p.queue.drain() {
+			if p.cancelQueued(t) {
+				p.unstarted = append(p.unstarted, t.task)
+			}
+		}
+	case ShutdownImmediate:
+		p.cancel()
+		for _, t := range p.queue.drain() {
+			p.cancelQueued(t)
+		}
+	default:
+		p.logger.Info("draining queued tasks", "queued", p.queue.len(), "routines", atomic.LoadInt64(&p.routines))
+	}
+	p.waitWorkers(options.Timeout)
+	p.retrying.Wait()
+	p.killChannel <- struct{}{}
+}
+
+// cancelQueued complete queued task as cancelled by shutdown, false is returned if it was cancelled before
+func (p *engine[Out]) cancelQueued(t internalTask[Out]) bool {
+	status, ok := t.future.complete(TypedStatus[Out]{ID: t.id, Name: t.task.GetName(), AssignTime: t.AssignTime, Err: ErrShuttingDown, Attempts: t.attempts})
+	if ok {
+		p.statusChannel <- status
+	}
+	return ok
+}
+
+// waitWorkers wait for routines to stop, tasks are cancelled once timeout is passed
+func (p *engine[Out]) waitWorkers(timeout time.Duration) {
+	defer p.cancel()
+	if timeout <= 0 {
+		p.workers.Wait()
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		p.logger.Info("shutdown timeout is passed, cancel tasks", "queued", p.queue.len(), "busy", atomic.LoadInt64(&p.busy))
+		p.cancel()
+		<-done
+	}
+}
@@ -0,0 +1,183 @@
+package pool
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+const (
+	defaultStatsSamples = 1024
+	throughputSeconds   = 15 * 60
+)
+
+// throughputWindows sliding windows of Stats.Throughput
+var throughputWindows = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+}
+
+// Stats statistics of pool
+type Stats struct {
+	Queued  int `json:"queued"`
+	Running int `json:"running"`
+	TaskStats
+	// Throughput completed tasks per second over the last 1m, 5m and 15m
+	Throughput map[string]float64 `json:"throughput"`
+	// Tasks statistics by task name
+	Tasks map[string]TaskStats `json:"tasks"`
+}
+
+// TaskStats statistics of done tasks, latencies are computed over the most recent StatsSamples tasks
+type TaskStats struct {
+	Completed   int64   `json:"completed"`
+	Succeeded   int64   `json:"succeeded"`
+	Failed      int64   `json:"failed"`
+	Cancelled   int64   `json:"cancelled"`
+	SuccessRate float64 `json:"successRate"`
+	FailureRate float64 `json:"failureRate"`
+	// Run duration of running tasks
+	Run Latency `json:"run"`
+	// Wait time in queue from AssignTime to StartTime
+	Wait Latency `json:"wait"`
+}
+
+// Latency percentiles of durations
+type Latency struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+}
+
+// samples ring of recent durations
+type samples struct {
+	values []float64
+	next   int
+}
+
+func (s *samples) add(d time.Duration, size int) {
+	if len(s.values) < size {
+		s.values = append(s.values, float64(d))
+		return
+	}
+	s.values[s.next] = float64(d)
+	s.next = (s.next + 1) % size
+}
+
+func (s *samples) latency() Latency {
+	if len(s.values) == 0 {
+		return Latency{}
+	}
+	sorted := append([]float64(nil), s.values...)
+	sort.Float64s(sorted)
+	q := func(p float64) time.Duration {
+		return time.Duration(stat.Quantile(p, stat.Empirical, sorted, nil))
+	}
+	return Latency{P50: q(0.5), P90: q(0.9), P99: q(0.99)}
+}
+
+type taskCounter struct {
+	completed, succeeded, failed, cancelled int64
+	run, wait                               samples
+}
+
+func (c *taskCounter) add(state TaskState, run time.Duration, wait time.Duration, started bool, size int) {
+	c.completed++
+	switch state {
+	case TaskSucceeded:
+		c.succeeded++
+	case TaskFailed:
+		c.failed++
+	default:
+		c.cancelled++
+	}
+	if started {
+		c.run.add(run, size)
+		c.wait.add(wait, size)
+	}
+}
+
+func (c *taskCounter) stats() TaskStats {
+	s := TaskStats{Completed: c.completed, Succeeded: c.succeeded, Failed: c.failed, Cancelled: c.cancelled, Run: c.run.latency(), Wait: c.wait.latency()}
+	if c.completed > 0 {
+		s.SuccessRate = float64(c.succeeded) / float64(c.completed)
+		s.FailureRate = float64(c.failed) / float64(c.completed)
+	}
+	return s
+}
+
+// statsCollector statistics of done tasks
+type statsCollector struct {
+	mu      sync.Mutex
+	size    int
+	total   taskCounter
+	byName  map[string]*taskCounter
+	buckets [throughputSeconds]int64 // completed tasks by second
+	last    int64                    // unix second of the latest bucket
+}
+
+func newStatsCollector(size int) *statsCollector {
+	if size <= 0 {
+		size = defaultStatsSamples
+	}
+	return &statsCollector{size: size, byName: map[string]*taskCounter{}}
+}
+
+// record add status of done task
+func (c *statsCollector) record(name string, state TaskState, assigned time.Time, started time.Time, run time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wait := started.Sub(assigned)
+	c.total.add(state, run, wait, !started.IsZero(), c.size)
+	counter, ok := c.byName[name]
+	if !ok {
+		counter = &taskCounter{}
+		c.byName[name] = counter
+	}
+	counter.add(state, run, wait, !started.IsZero(), c.size)
+	c.advance(now.Unix())
+	c.buckets[now.Unix()%throughputSeconds]++
+}
+
+// advance clear buckets of seconds passed since the latest bucket. The lock must be held.
+func (c *statsCollector) advance(second int64) {
+	if second <= c.last {
+		return
+	}
+	for s := max(c.last+1, second-throughputSeconds+1); s <= second; s++ {
+		c.buckets[s%throughputSeconds] = 0
+	}
+	c.last = second
+}
+
+func (c *statsCollector) stats(now time.Time) Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Stats{TaskStats: c.total.stats(), Throughput: map[string]float64{}, Tasks: map[string]TaskStats{}}
+	second := now.Unix()
+	c.advance(second)
+	for name, window := range throughputWindows {
+		seconds := int64(window / time.Second)
+		var count int64
+		for i := int64(0); i < seconds; i++ {
+			count += c.buckets[(second-i)%throughputSeconds]
+		}
+		s.Throughput[name] = float64(count) / float64(seconds)
+	}
+	for name, counter := range c.byName {
+		s.Tasks[name] = counter.stats()
+	}
+	return s
+}
+
+// Stats statistics of queued, running and done tasks
+func (p *engine[Out]) Stats() Stats {
+	s := p.stats.stats(time.Now())
+	s.Queued = p.queue.len()
+	s.Running = int(atomic.LoadInt64(&p.busy))
+	return s
+}
@@ -0,0 +1,88 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+var ErrTaskCancelled = errors.New("task is cancelled")
+var ErrTaskNotFound = errors.New("task is not found")
+
+// ContextTask task which stops when ctx is done
+type ContextTask = TypedTask[interface{}]
+
+// TypedTask task with result of type Out, it stops when ctx is done
+type TypedTask[Out any] interface {
+	GetName() string
+	RunContext(ctx context.Context, workRoutine int) (Out, error)
+}
+
+// Adapt adapt task to ContextTask, task is returned as is if it implements ContextTask.
+// Run of adapted task does not see the context, the routine stops waiting for it when the context is done.
+func Adapt(task Task) ContextTask {
+	if t, ok := task.(ContextTask); ok {
+		return t
+	}
+	return &taskAdapter{task: task}
+}
+
+type taskAdapter struct {
+	task Task
+}
+
+func (a *taskAdapter) GetName() string {
+	return a.task.GetName()
+}
+
+func (a *taskAdapter) RunContext(ctx context.Context, workRoutine int) (interface{}, error) {
+	return a.task.Run(workRoutine)
+}
+
+// PanicError error of task which panicked
+type PanicError struct {
+	Value interface{}
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panic: %v", e.Value)
+}
+
+type taskResult[Out any] struct {
+	data Out
+	err  error
+}
+
+// runTask run task in its own goroutine, recover panic into PanicError.
+// It returns when the task is done or ctx is done, a task ignoring ctx is left running and abandoned is true.
+func runTask[Out any](ctx context.Context, task TypedTask[Out], workRoutine int) (data Out, err error, abandoned bool) {
+	done := make(chan taskResult[Out], 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				done <- taskResult[Out]{err: &PanicError{Value: v, Stack: string(debug.Stack())}}
+			}
+		}()
+		data, err := task.RunContext(ctx, workRoutine)
+		done <- taskResult[Out]{data: data, err: err}
+	}()
+	select {
+	case r := <-done:
+		if r.err != nil && ctx.Err() != nil && errors.Is(r.err, ctx.Err()) {
+			return r.data, contextError(ctx), false
+		}
+		return r.data, r.err, false
+	case <-ctx.Done():
+		return data, contextError(ctx), true
+	}
+}
+
+// contextError ErrTaskCancelled if ctx is cancelled, otherwise the deadline error
+func contextError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return ErrTaskCancelled
+	}
+	return ctx.Err()
+}
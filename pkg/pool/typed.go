@@ -0,0 +1,96 @@
+package pool
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-logr/logr"
+)
+
+// Handler process input of type In into result of type Out
+type Handler[In any, Out any] func(ctx context.Context, in In) (Out, error)
+
+// TypedPool pool running handler on inputs of type In with results of type Out
+type TypedPool[In any, Out any] struct {
+	*engine[Out]
+	name    string
+	handler Handler[In, Out]
+}
+
+// NewTypedPool create new pool which runs handler on submitted inputs, tasks are named after options.Name
+func NewTypedPool[In any, Out any](options Options, handler Handler[In, Out], logger *logr.Logger) *TypedPool[In, Out] {
+	e := newEngine[Out](options, logger)
+	return &TypedPool[In, Out]{engine: e, name: e.options.Name, handler: handler}
+}
+
+// Submit queue input with options, it blocks while the queue is full and overflow policy is block
+func (p *TypedPool[In, Out]) Submit(in In, options ...DispatchOptions) (*TypedFuture[Out], error) {
+	return p.SubmitTask(&inputTask[In, Out]{name: p.name, in: in, handler: p.handler}, options...)
+}
+
+// TrySubmit queue input without blocking, ErrQueueFull is returned if the queue is full and overflow policy is not drop-oldest
+func (p *TypedPool[In, Out]) TrySubmit(in In, options ...DispatchOptions) (*TypedFuture[Out], error) {
+	return p.TrySubmitTask(&inputTask[In, Out]{name: p.name, in: in, handler: p.handler}, options...)
+}
+
+// Stream submit inputs until the channel is closed or ctx is done, statuses are sent in order of completion.
+// The returned channel is closed once all submitted tasks are done, or when ctx is done.
+func (p *TypedPool[In, Out]) Stream(ctx context.Context, inputs <-chan In, options ...DispatchOptions) <-chan TypedStatus[Out] {
+	results := make(chan TypedStatus[Out])
+	go func() {
+		wg := sync.WaitGroup{}
+		defer func() {
+			wg.Wait()
+			close(results)
+		}()
+		for {
+			var in In
+			var ok bool
+			select {
+			case in, ok = <-inputs:
+			case <-ctx.Done():
+				return
+			}
+			if !ok {
+				return
+			}
+			f, err := p.Submit(in, options...)
+			if err != nil {
+				select {
+				case results <- TypedStatus[Out]{Name: p.name, State: TaskFailed, Err: err}:
+				case <-ctx.Done():
+				}
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				select {
+				case <-f.Done():
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case results <- f.TaskStatus():
+				case <-ctx.Done():
+				}
+			}()
+		}
+	}()
+	return results
+}
+
+// inputTask task running handler of pool on input
+type inputTask[In any, Out any] struct {
+	name    string
+	in      In
+	handler Handler[In, Out]
+}
+
+func (t *inputTask[In, Out]) GetName() string {
+	return t.name
+}
+
+func (t *inputTask[In, Out]) RunContext(ctx context.Context, workRoutine int) (Out, error) {
+	return t.handler(ctx, t.in)
+}